@@ -0,0 +1,465 @@
+// Package client speaks the NetQuake protocol to a server as a headless
+// player, so that a server may be exercised from Go: it connects, completes
+// the signon, sends scripted moves and string commands, and decodes what the
+// server sends back into messages and the client's view of the game.
+//
+// A Client is not safe for concurrent use.  It does nothing in the
+// background; the reliable channel only makes progress while Read runs.
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+	"github.com/matttproud/go-quake/qtype"
+)
+
+const (
+	maxDatagramData = protonetquake.MaxDatagram - protonetquake.NetHeaderSize
+
+	// ResendInterval is how long an unacknowledged reliable datagram waits
+	// before it is sent again.
+	ResendInterval = time.Second
+)
+
+type ErrRejected string
+
+func (e ErrRejected) Error() string { return "client: connection rejected: " + string(e) }
+
+type ErrDisconnected string
+
+func (e ErrDisconnected) Error() string { return "client: disconnected: " + string(e) }
+
+// Stats counts the traffic of a Client.
+type Stats struct {
+	DatagramsIn, DatagramsOut uint64
+	BytesIn, BytesOut         uint64
+	ReliableSent              uint64 // reliable datagrams, counting resends
+	Resends                   uint64
+	Stale                     uint64 // unreliable datagrams that arrived late
+}
+
+// State is the client's view of the game, updated from each message read.
+type State struct {
+	ServerInfo ServerInfo
+	SignOn     int
+	Time       float32
+	Paused     bool
+	ViewEntity int
+	Names      map[int]string
+	Frags      map[int]int
+	Colors     map[int]int
+	Stats      map[int]int32
+	ClientData ClientData
+	Baselines  map[int]Entity
+	Entities   map[int]Entity // as of the latest entity updates
+}
+
+// Client is a connection to a server.
+type Client struct {
+	Conn net.PacketConn
+	// Addr is the address of the socket that serves the client.
+	Addr  net.Addr
+	State State
+	Stats Stats
+
+	unreliableSeq int
+	recvSeq       int // next reliable datagram expected
+	unreliableIn  int // next unreliable datagram expected
+	received      []byte
+
+	sendSeq  int
+	sending  []byte // remainder of the reliable message in flight
+	lastSend time.Time
+	pending  bytes.Buffer // reliable commands queued behind the one in flight
+
+	disconnected bool
+}
+
+func connectRequest() []byte {
+	payload := append([]byte("QUAKE\x00"), protonetquake.NetProtocolVersion)
+	return protonetquake.CtrlPacket(protonetquake.CCReqConnect, payload)
+}
+
+// Connect asks the server at addr for a connection over conn, retrying as the
+// stock client does until ctx ends.
+func Connect(ctx context.Context, conn net.PacketConn, addr net.Addr) (*Client, error) {
+	req := connectRequest()
+	var buf [protonetquake.MaxDatagram]byte
+	for {
+		if _, err := conn.WriteTo(req, addr); err != nil {
+			return nil, err
+		}
+		dl := time.Now().Add(2500 * time.Millisecond)
+		if ctxDl, ok := ctx.Deadline(); ok && ctxDl.Before(dl) {
+			dl = ctxDl
+		}
+		if err := conn.SetReadDeadline(dl); err != nil {
+			return nil, err
+		}
+		for {
+			n, from, err := conn.ReadFrom(buf[:])
+			if isTimeout(err) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if from.String() != addr.String() {
+				continue
+			}
+			port, err := parseAccept(buf[:n])
+			if err != nil {
+				if _, ok := err.(ErrRejected); ok {
+					return nil, err
+				}
+				continue
+			}
+			c := &Client{Conn: conn, Addr: withPort(addr, port)}
+			c.State.reset()
+			return c, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func parseAccept(data []byte) (port int, err error) {
+	if len(data) < protonetquake.CtrlHeaderSize {
+		return 0, ErrBadMessage("short control reply")
+	}
+	cmd, payload, ok := protonetquake.ParseCtrl(data)
+	if !ok {
+		return 0, ErrBadMessage("not a control reply")
+	}
+	switch cmd {
+	case protonetquake.CCRepAccept:
+		if len(payload) < 4 {
+			return 0, ErrBadMessage("short accept")
+		}
+		return int(int32(binary.LittleEndian.Uint32(payload))), nil
+	case protonetquake.CCRepReject:
+		return 0, ErrRejected(string(bytes.TrimRight(payload, "\x00")))
+	}
+	return 0, ErrBadMessage(fmt.Sprintf("control reply %#x", cmd))
+}
+
+// withPort is addr with its port replaced.
+func withPort(addr net.Addr, port int) net.Addr {
+	if u, ok := addr.(*net.UDPAddr); ok {
+		return &net.UDPAddr{IP: u.IP, Port: port, Zone: u.Zone}
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	a, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, fmt.Sprint(port)))
+	if err != nil {
+		return addr
+	}
+	return a
+}
+
+func isTimeout(err error) bool {
+	nerr, ok := err.(net.Error)
+	return ok && nerr.Timeout()
+}
+
+func (s *State) reset() {
+	*s = State{
+		Names:     make(map[int]string),
+		Frags:     make(map[int]int),
+		Colors:    make(map[int]int),
+		Stats:     make(map[int]int32),
+		Baselines: make(map[int]Entity),
+		Entities:  make(map[int]Entity),
+	}
+}
+
+// apply updates the state with m.
+func (s *State) apply(m Message) {
+	switch m := m.(type) {
+	case ServerInfo:
+		s.reset()
+		s.ServerInfo = m
+	case SignOnNum:
+		s.SignOn = m.Stage
+	case Time:
+		s.Time = m.Time
+	case SetPause:
+		s.Paused = m.Paused
+	case SetView:
+		s.ViewEntity = m.Entity
+	case UpdateName:
+		s.Names[m.Slot] = m.Name
+	case UpdateFrags:
+		s.Frags[m.Slot] = m.Frags
+	case UpdateColors:
+		s.Colors[m.Slot] = m.Colors
+	case UpdateStat:
+		s.Stats[m.Index] = m.Value
+	case ClientData:
+		s.ClientData = m
+	case SpawnBaseline:
+		s.Baselines[m.Num] = m.Entity
+	case EntityUpdate:
+		s.Entities[m.Num] = m.Apply(s.Baselines[m.Num])
+	}
+}
+
+func (c *Client) write(flags uint32, seq int, data []byte) error {
+	msg := make([]byte, protonetquake.NetHeaderSize+len(data))
+	binary.BigEndian.PutUint32(msg[0:4], flags|uint32(len(msg)))
+	binary.BigEndian.PutUint32(msg[4:8], uint32(seq))
+	copy(msg[protonetquake.NetHeaderSize:], data)
+	if _, err := c.Conn.WriteTo(msg, c.Addr); err != nil {
+		return err
+	}
+	c.Stats.DatagramsOut++
+	c.Stats.BytesOut += uint64(len(msg))
+	return nil
+}
+
+// SendUnreliable sends the client commands in msg without guarantee of
+// delivery.
+func (c *Client) SendUnreliable(msg []byte) error {
+	seq := c.unreliableSeq
+	c.unreliableSeq++
+	return c.write(protonetquake.NetflagUnreliable, seq, msg)
+}
+
+// SendReliable queues the client commands in msg for delivery in order.
+func (c *Client) SendReliable(msg []byte) error {
+	c.pending.Write(msg)
+	if c.sending != nil {
+		return nil
+	}
+	return c.flush()
+}
+
+// flush starts the delivery of the queued commands.
+func (c *Client) flush() error {
+	if c.pending.Len() == 0 {
+		return nil
+	}
+	c.sending = append([]byte(nil), c.pending.Bytes()...)
+	c.pending.Reset()
+	return c.sendChunk()
+}
+
+func (c *Client) sendChunk() error {
+	data, flags := c.sending, protonetquake.NetflagData|protonetquake.NetflagEOM
+	if len(data) > maxDatagramData {
+		data, flags = data[:maxDatagramData], protonetquake.NetflagData
+	}
+	c.lastSend = time.Now()
+	c.Stats.ReliableSent++
+	return c.write(flags, c.sendSeq, data)
+}
+
+// Cmd sends text as a reliable clc_stringcmd, as the console's cmd does.
+func (c *Client) Cmd(text string) error {
+	msg := append([]byte{protonetquake.CLCStringCommand}, text...)
+	return c.SendReliable(append(msg, 0))
+}
+
+// Move is the input of a clc_move.
+type Move struct {
+	Time    float32 // server time the move answers, by which ping is measured
+	Angles  qtype.Vec3
+	Forward int16
+	Side    int16
+	Up      int16
+	Buttons byte
+	Impulse byte
+}
+
+// Encode encodes m as a clc_move.
+func (m Move) Encode() []byte {
+	out := make([]byte, 16)
+	out[0] = protonetquake.CLCMove
+	binary.LittleEndian.PutUint32(out[1:5], math.Float32bits(m.Time))
+	for i, a := range m.Angles {
+		out[5+i] = byte(int(a*256/360) & 255)
+	}
+	binary.LittleEndian.PutUint16(out[8:10], uint16(m.Forward))
+	binary.LittleEndian.PutUint16(out[10:12], uint16(m.Side))
+	binary.LittleEndian.PutUint16(out[12:14], uint16(m.Up))
+	out[14] = m.Buttons
+	out[15] = m.Impulse
+	return out
+}
+
+// Move sends m unreliably, as the client does each frame.
+func (c *Client) Move(m Move) error { return c.SendUnreliable(m.Encode()) }
+
+// Disconnect tells the server that the client is leaving.
+func (c *Client) Disconnect() error {
+	c.disconnected = true
+	return c.SendUnreliable([]byte{protonetquake.CLCDisconnect})
+}
+
+// Read waits for server commands, handles them and returns them once they
+// have been applied to State.  Meanwhile it retransmits the reliable message
+// in flight.
+func (c *Client) Read(ctx context.Context) ([]Message, error) {
+	for {
+		msgs, err := c.readDatagram(ctx)
+		if err != nil || len(msgs) > 0 {
+			return msgs, err
+		}
+	}
+}
+
+// readDatagram handles at most one datagram from the server, giving up when
+// the reliable message in flight falls due for retransmission.
+func (c *Client) readDatagram(ctx context.Context) ([]Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.sending != nil && time.Since(c.lastSend) >= ResendInterval {
+		c.Stats.Resends++
+		if err := c.sendChunk(); err != nil {
+			return nil, err
+		}
+	}
+	dl := time.Now().Add(ResendInterval)
+	if c.sending != nil {
+		dl = c.lastSend.Add(ResendInterval)
+	}
+	if ctxDl, ok := ctx.Deadline(); ok && ctxDl.Before(dl) {
+		dl = ctxDl
+	}
+	if err := c.Conn.SetReadDeadline(dl); err != nil {
+		return nil, err
+	}
+	var buf [protonetquake.MaxDatagram]byte
+	n, from, err := c.Conn.ReadFrom(buf[:])
+	switch {
+	case isTimeout(err):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	case from.String() != c.Addr.String():
+		return nil, nil
+	}
+	c.Stats.DatagramsIn++
+	c.Stats.BytesIn += uint64(n)
+	return c.handle(buf[:n])
+}
+
+func (c *Client) handle(data []byte) ([]Message, error) {
+	if len(data) < protonetquake.NetHeaderSize {
+		return nil, nil
+	}
+	hdr := binary.BigEndian.Uint32(data)
+	flags, seq := hdr&^protonetquake.NetflagLengthMask, int(binary.BigEndian.Uint32(data[4:8]))
+	if flags&protonetquake.NetflagControl != 0 || int(hdr&protonetquake.NetflagLengthMask) != len(data) {
+		return nil, nil
+	}
+	data = data[protonetquake.NetHeaderSize:]
+	switch {
+	case flags&protonetquake.NetflagUnreliable != 0:
+		if seq < c.unreliableIn {
+			c.Stats.Stale++
+			return nil, nil
+		}
+		c.unreliableIn = seq + 1
+		return c.parse(data)
+	case flags&protonetquake.NetflagAck != 0:
+		if c.sending == nil || seq != c.sendSeq {
+			return nil, nil
+		}
+		c.sendSeq++
+		if len(c.sending) > maxDatagramData {
+			c.sending = c.sending[maxDatagramData:]
+			return nil, c.sendChunk()
+		}
+		c.sending = nil
+		return nil, c.flush()
+	case flags&protonetquake.NetflagData != 0:
+		if err := c.write(protonetquake.NetflagAck, seq, nil); err != nil {
+			return nil, err
+		}
+		if seq != c.recvSeq {
+			return nil, nil
+		}
+		c.recvSeq++
+		c.received = append(c.received, data...)
+		if flags&protonetquake.NetflagEOM == 0 {
+			return nil, nil
+		}
+		msg := c.received
+		c.received = nil
+		return c.parse(msg)
+	}
+	return nil, nil
+}
+
+func (c *Client) parse(data []byte) ([]Message, error) {
+	msgs, err := Parse(data)
+	for _, m := range msgs {
+		c.State.apply(m)
+		if _, ok := m.(Disconnect); ok {
+			c.disconnected = true
+		}
+	}
+	if err == nil && c.disconnected {
+		err = ErrDisconnected("by server")
+	}
+	return msgs, err
+}
+
+// SignOn answers the server's signon stages as the stock client does, giving
+// name and colors, and returns once the client has begun.
+func (c *Client) SignOn(ctx context.Context, name string, colors int) error {
+	for c.State.SignOn < 3 {
+		msgs, err := c.Read(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			stage, ok := m.(SignOnNum)
+			if !ok {
+				continue
+			}
+			switch stage.Stage {
+			case 1:
+				err = c.Cmd("prespawn")
+			case 2:
+				err = c.Cmd(fmt.Sprintf("name \"%s\"", name))
+				if err == nil {
+					err = c.Cmd(fmt.Sprintf("color %d %d", colors>>4, colors&15))
+				}
+				if err == nil {
+					err = c.Cmd("spawn")
+				}
+			case 3:
+				err = c.Cmd("begin")
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	c.State.SignOn = 4
+	return c.Sync(ctx)
+}
+
+// Sync waits until the server has acknowledged every reliable command sent.
+func (c *Client) Sync(ctx context.Context) error {
+	for c.sending != nil || c.pending.Len() > 0 {
+		if _, err := c.readDatagram(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
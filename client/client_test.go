@@ -0,0 +1,167 @@
+package client
+
+import (
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/matttproud/go-quake/memnet"
+	"github.com/matttproud/go-quake/server"
+)
+
+func newTestServer(t *testing.T, ctrl net.PacketConn, listen func() (net.PacketConn, error)) *server.Server {
+	srv, err := server.New(server.Config{
+		Conn:          ctrl,
+		ListenSession: listen,
+		Logger:        log.New(io.Discard, "", 0),
+		Console:       io.Discard,
+		MaxPlayers:    4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Loop(context.Background())
+	return srv
+}
+
+// readUntil reads until a message satisfies ok.
+func readUntil(ctx context.Context, t *testing.T, c *Client, ok func(Message) bool) {
+	for {
+		msgs, err := c.Read(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range msgs {
+			if ok(m) {
+				return
+			}
+		}
+	}
+}
+
+func testPlay(t *testing.T, srv *server.Server, c *Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.SignOn(ctx, "Ranger", 0x4f); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.State.ServerInfo.MaxClients, 4; got != want {
+		t.Errorf("max clients = %v, want = %v", got, want)
+	}
+	// The server holds the name given during signon until the client begins.
+	if c.State.Names[c.State.ViewEntity-1] != "Ranger" {
+		readUntil(ctx, t, c, func(m Message) bool {
+			u, ok := m.(UpdateName)
+			return ok && u.Name == "Ranger"
+		})
+	}
+	if got, want := c.State.Names[c.State.ViewEntity-1], "Ranger"; got != want {
+		t.Errorf("name = %q, want = %q", got, want)
+	}
+
+	if err := c.Move(Move{Time: c.State.Time, Forward: 200}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Cmd("say hello"); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(ctx, t, c, func(m Message) bool {
+		p, ok := m.(Print)
+		return ok && strings.Contains(p.Text, "Ranger: hello")
+	})
+
+	var name string
+	var spawned bool
+	if err := srv.Do(ctx, func() {
+		for _, sess := range srv.Sessions {
+			name, spawned = sess.Player.Name, sess.Spawned
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if name != "Ranger" || !spawned {
+		t.Errorf("server sees %q, spawned %v; want = %q, spawned", name, spawned, "Ranger")
+	}
+
+	if err := c.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	for n := 1; n > 0; {
+		if err := srv.Do(ctx, func() { n = srv.Sessions.Len() }); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPlayMemnet(t *testing.T) {
+	var nw memnet.Network
+	ctrl, err := nw.Listen("127.0.0.1:26000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, ctrl, nw.ListenPacket("127.0.0.1:0"))
+	defer srv.Close()
+	conn, err := nw.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c, err := Connect(context.Background(), conn, ctrl.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPlay(t, srv, c)
+}
+
+func TestPlayUDP(t *testing.T) {
+	ctrl, err := server.Listen(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, ctrl, nil)
+	defer srv.Close()
+	conn, err := net.ListenPacket("udp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c, err := Connect(context.Background(), conn, ctrl.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPlay(t, srv, c)
+}
+
+func TestConnectRejected(t *testing.T) {
+	var nw memnet.Network
+	ctrl, err := nw.Listen("127.0.0.1:26000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, ctrl, nw.ListenPacket("127.0.0.1:0"))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var berr error
+	if err := srv.Do(ctx, func() { berr = srv.Exec("ban 127.0.0.1 cheating") }); err != nil {
+		t.Fatal(err)
+	}
+	if berr != nil {
+		t.Fatal(berr)
+	}
+	conn, err := nw.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := Connect(ctx, conn, ctrl.LocalAddr()); err == nil {
+		t.Fatal("connected while banned")
+	} else if _, ok := err.(ErrRejected); !ok {
+		t.Errorf("got = %v, want = rejection", err)
+	}
+}
@@ -0,0 +1,500 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+	"github.com/matttproud/go-quake/qtype"
+)
+
+// The server messages are decoded as cl_parse.c does for protocol 15.
+
+// Message is a decoded server command.
+type Message interface {
+	// Cmd is the svc_ number of the command, or fastUpdate for an entity
+	// update.
+	Cmd() byte
+}
+
+// fastUpdate is the bit that marks an entity update in place of a command.
+const fastUpdate = 0x80
+
+type (
+	Nop        struct{}
+	Disconnect struct{}
+	UpdateStat struct {
+		Index int
+		Value int32
+	}
+	Version struct{ Protocol int32 }
+	SetView struct{ Entity int }
+	Sound   struct {
+		Volume      int
+		Attenuation float32
+		Entity      int
+		Channel     int
+		Sound       int
+		Origin      qtype.Vec3
+	}
+	Time       struct{ Time float32 }
+	Print      struct{ Text string }
+	StuffText  struct{ Text string }
+	SetAngle   struct{ Angles qtype.Vec3 }
+	ServerInfo struct {
+		Protocol   int32
+		MaxClients int
+		GameType   byte
+		Level      string
+		Models     []string
+		Sounds     []string
+	}
+	LightStyle struct {
+		Style int
+		Map   string
+	}
+	UpdateName struct {
+		Slot int
+		Name string
+	}
+	UpdateFrags struct {
+		Slot  int
+		Frags int
+	}
+	ClientData struct {
+		Bits         int
+		ViewHeight   int
+		IdealPitch   int
+		Punch        [3]int
+		Velocity     [3]int
+		Items        int32
+		WeaponFrame  int
+		Armor        int
+		Weapon       int
+		Health       int
+		CurrentAmmo  int
+		Ammo         [4]int // shells, nails, rockets and cells
+		ActiveWeapon int
+	}
+	StopSound    struct{ Channel int }
+	UpdateColors struct {
+		Slot   int
+		Colors int
+	}
+	Particle struct {
+		Origin    qtype.Vec3
+		Direction [3]int
+		Count     int
+		Color     int
+	}
+	Damage struct {
+		Armor, Blood int
+		From         qtype.Vec3
+	}
+	SpawnStatic   struct{ Entity }
+	SpawnBaseline struct {
+		Num int
+		Entity
+	}
+	TempEntity struct {
+		Type       byte
+		Entity     int // of the beam
+		Origin     qtype.Vec3
+		End        qtype.Vec3 // of the beam
+		ColorStart int        // of TE_EXPLOSION2
+		ColorLen   int
+	}
+	SetPause         struct{ Paused bool }
+	SignOnNum        struct{ Stage int }
+	CenterPrint      struct{ Text string }
+	KilledMonster    struct{}
+	FoundSecret      struct{}
+	SpawnStaticSound struct {
+		Origin      qtype.Vec3
+		Sound       int
+		Volume      int
+		Attenuation int
+	}
+	Intermission struct{}
+	Finale       struct{ Text string }
+	CDTrack      struct{ Track, Loop int }
+	SellScreen   struct{}
+	CutScene     struct{ Text string }
+	// EntityUpdate carries the fields of an entity that differ from its
+	// baseline; those absent from Bits are zero.
+	EntityUpdate struct {
+		Bits int
+		Num  int
+		Entity
+	}
+)
+
+func (Nop) Cmd() byte              { return protonetquake.SVCNop }
+func (Disconnect) Cmd() byte       { return protonetquake.SVCDisconnect }
+func (UpdateStat) Cmd() byte       { return protonetquake.SVCUpdateStat }
+func (Version) Cmd() byte          { return protonetquake.SVCVersion }
+func (SetView) Cmd() byte          { return protonetquake.SVCSetView }
+func (Sound) Cmd() byte            { return protonetquake.SVCSound }
+func (Time) Cmd() byte             { return protonetquake.SVCTime }
+func (Print) Cmd() byte            { return protonetquake.SVCPrint }
+func (StuffText) Cmd() byte        { return protonetquake.SVCStuffText }
+func (SetAngle) Cmd() byte         { return protonetquake.SVCSetAngle }
+func (ServerInfo) Cmd() byte       { return protonetquake.SVCServerInfo }
+func (LightStyle) Cmd() byte       { return protonetquake.SVCLightStyle }
+func (UpdateName) Cmd() byte       { return protonetquake.SVCUpdateName }
+func (UpdateFrags) Cmd() byte      { return protonetquake.SVCUpdateFrags }
+func (ClientData) Cmd() byte       { return protonetquake.SVCClientData }
+func (StopSound) Cmd() byte        { return protonetquake.SVCStopSound }
+func (UpdateColors) Cmd() byte     { return protonetquake.SVCUpdateColors }
+func (Particle) Cmd() byte         { return protonetquake.SVCParticle }
+func (Damage) Cmd() byte           { return protonetquake.SVCDamage }
+func (SpawnStatic) Cmd() byte      { return protonetquake.SVCSpawnStatic }
+func (SpawnBaseline) Cmd() byte    { return protonetquake.SVCSpawnBaseline }
+func (TempEntity) Cmd() byte       { return protonetquake.SVCTempEntity }
+func (SetPause) Cmd() byte         { return protonetquake.SVCSetPause }
+func (SignOnNum) Cmd() byte        { return protonetquake.SVCSignOnNum }
+func (CenterPrint) Cmd() byte      { return protonetquake.SVCCenterPrint }
+func (KilledMonster) Cmd() byte    { return protonetquake.SVCKilledMonster }
+func (FoundSecret) Cmd() byte      { return protonetquake.SVCFoundSecret }
+func (SpawnStaticSound) Cmd() byte { return protonetquake.SVCSpawnStaticSound }
+func (Intermission) Cmd() byte     { return protonetquake.SVCIntermission }
+func (Finale) Cmd() byte           { return protonetquake.SVCFinale }
+func (CDTrack) Cmd() byte          { return protonetquake.SVCCDTrack }
+func (SellScreen) Cmd() byte       { return protonetquake.SVCSellScreen }
+func (CutScene) Cmd() byte         { return protonetquake.SVCCutScene }
+func (EntityUpdate) Cmd() byte     { return fastUpdate }
+
+// Entity is the visible state of an entity.
+type Entity struct {
+	Model    int
+	Frame    int
+	Colormap int
+	Skin     int
+	Effects  int
+	Origin   qtype.Vec3
+	Angles   qtype.Vec3
+}
+
+// Bits of svc_clientdata.
+const (
+	SUViewHeight  = 1 << 0
+	SUIdealPitch  = 1 << 1
+	SUPunch1      = 1 << 2
+	SUVelocity1   = 1 << 5
+	SUItems       = 1 << 9
+	SUOnGround    = 1 << 10
+	SUInWater     = 1 << 11
+	SUWeaponFrame = 1 << 12
+	SUArmor       = 1 << 13
+	SUWeapon      = 1 << 14
+)
+
+// Bits of an entity update.
+const (
+	UMoreBits   = 1 << 0
+	UOrigin1    = 1 << 1
+	UOrigin2    = 1 << 2
+	UOrigin3    = 1 << 3
+	UAngle2     = 1 << 4
+	UNoLerp     = 1 << 5
+	UFrame      = 1 << 6
+	USignal     = 1 << 7
+	UAngle1     = 1 << 8
+	UAngle3     = 1 << 9
+	UModel      = 1 << 10
+	UColormap   = 1 << 11
+	USkin       = 1 << 12
+	UEffects    = 1 << 13
+	ULongEntity = 1 << 14
+)
+
+type ErrBadMessage string
+
+func (e ErrBadMessage) Error() string { return "client: bad server message: " + string(e) }
+
+// reader reads the MSG_Read* encodings, remembering the first underflow.
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	if len(r.data) < n {
+		r.err = ErrBadMessage("truncated")
+		r.data = nil
+		return make([]byte, n)
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) byte() int          { return int(r.next(1)[0]) }
+func (r *reader) char() int          { return int(int8(r.next(1)[0])) }
+func (r *reader) short() int         { return int(int16(binary.LittleEndian.Uint16(r.next(2)))) }
+func (r *reader) long() int32        { return int32(binary.LittleEndian.Uint32(r.next(4))) }
+func (r *reader) float() float32     { return math.Float32frombits(binary.LittleEndian.Uint32(r.next(4))) }
+func (r *reader) coord() qtype.Float { return qtype.Float(r.short()) / 8 }
+func (r *reader) angle() qtype.Float { return qtype.Float(r.char()) * 360 / 256 }
+
+func (r *reader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	n := bytes.IndexByte(r.data, 0)
+	if n == -1 {
+		r.err = ErrBadMessage("unterminated string")
+		r.data = nil
+		return ""
+	}
+	s := string(r.data[:n])
+	r.data = r.data[n+1:]
+	return s
+}
+
+func (r *reader) vec() qtype.Vec3 { return qtype.Vec3{r.coord(), r.coord(), r.coord()} }
+
+func (r *reader) baseline() Entity {
+	e := Entity{Model: r.byte(), Frame: r.byte(), Colormap: r.byte(), Skin: r.byte()}
+	for i := 0; i < 3; i++ {
+		e.Origin[i] = r.coord()
+		e.Angles[i] = r.angle()
+	}
+	return e
+}
+
+// Parse decodes the server commands in data.
+func Parse(data []byte) ([]Message, error) {
+	r := &reader{data: data}
+	var out []Message
+	for len(r.data) > 0 {
+		cmd := byte(r.byte())
+		var m Message
+		if cmd&fastUpdate != 0 {
+			m = r.update(cmd)
+		} else {
+			var err error
+			if m, err = r.command(cmd); err != nil {
+				return out, err
+			}
+		}
+		if r.err != nil {
+			return out, r.err
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func (r *reader) update(cmd byte) EntityUpdate {
+	u := EntityUpdate{Bits: int(cmd &^ fastUpdate)}
+	if u.Bits&UMoreBits != 0 {
+		u.Bits |= r.byte() << 8
+	}
+	if u.Bits&ULongEntity != 0 {
+		u.Num = r.short()
+	} else {
+		u.Num = r.byte()
+	}
+	for _, f := range []struct {
+		bit int
+		v   *int
+	}{
+		{UModel, &u.Model}, {UFrame, &u.Frame}, {UColormap, &u.Colormap},
+		{USkin, &u.Skin}, {UEffects, &u.Effects},
+	} {
+		if u.Bits&f.bit != 0 {
+			*f.v = r.byte()
+		}
+	}
+	for i, bits := range [3][2]int{{UOrigin1, UAngle1}, {UOrigin2, UAngle2}, {UOrigin3, UAngle3}} {
+		if u.Bits&bits[0] != 0 {
+			u.Origin[i] = r.coord()
+		}
+		if u.Bits&bits[1] != 0 {
+			u.Angles[i] = r.angle()
+		}
+	}
+	return u
+}
+
+// Apply returns base with the fields of u in place of its own.
+func (u EntityUpdate) Apply(base Entity) Entity {
+	e := base
+	for _, f := range []struct {
+		bit      int
+		dst, src *int
+	}{
+		{UModel, &e.Model, &u.Model}, {UFrame, &e.Frame, &u.Frame},
+		{UColormap, &e.Colormap, &u.Colormap}, {USkin, &e.Skin, &u.Skin},
+		{UEffects, &e.Effects, &u.Effects},
+	} {
+		if u.Bits&f.bit != 0 {
+			*f.dst = *f.src
+		}
+	}
+	for i, bits := range [3][2]int{{UOrigin1, UAngle1}, {UOrigin2, UAngle2}, {UOrigin3, UAngle3}} {
+		if u.Bits&bits[0] != 0 {
+			e.Origin[i] = u.Origin[i]
+		}
+		if u.Bits&bits[1] != 0 {
+			e.Angles[i] = u.Angles[i]
+		}
+	}
+	return e
+}
+
+func (r *reader) command(cmd byte) (Message, error) {
+	switch cmd {
+	case protonetquake.SVCNop:
+		return Nop{}, nil
+	case protonetquake.SVCDisconnect:
+		return Disconnect{}, nil
+	case protonetquake.SVCUpdateStat:
+		return UpdateStat{Index: r.byte(), Value: r.long()}, nil
+	case protonetquake.SVCVersion:
+		return Version{Protocol: r.long()}, nil
+	case protonetquake.SVCSetView:
+		return SetView{Entity: r.short()}, nil
+	case protonetquake.SVCSound:
+		s := Sound{Volume: 255, Attenuation: 1}
+		mask := r.byte()
+		if mask&1 != 0 {
+			s.Volume = r.byte()
+		}
+		if mask&2 != 0 {
+			s.Attenuation = float32(r.byte()) / 64
+		}
+		ch := r.short()
+		s.Entity, s.Channel = ch>>3, ch&7
+		s.Sound = r.byte()
+		s.Origin = r.vec()
+		return s, nil
+	case protonetquake.SVCTime:
+		return Time{Time: r.float()}, nil
+	case protonetquake.SVCPrint:
+		return Print{Text: r.string()}, nil
+	case protonetquake.SVCStuffText:
+		return StuffText{Text: r.string()}, nil
+	case protonetquake.SVCSetAngle:
+		return SetAngle{Angles: qtype.Vec3{r.angle(), r.angle(), r.angle()}}, nil
+	case protonetquake.SVCServerInfo:
+		si := ServerInfo{Protocol: r.long(), MaxClients: r.byte(), GameType: byte(r.byte()), Level: r.string()}
+		for _, l := range []*[]string{&si.Models, &si.Sounds} {
+			for r.err == nil {
+				s := r.string()
+				if s == "" {
+					break
+				}
+				*l = append(*l, s)
+			}
+		}
+		return si, nil
+	case protonetquake.SVCLightStyle:
+		return LightStyle{Style: r.byte(), Map: r.string()}, nil
+	case protonetquake.SVCUpdateName:
+		return UpdateName{Slot: r.byte(), Name: r.string()}, nil
+	case protonetquake.SVCUpdateFrags:
+		return UpdateFrags{Slot: r.byte(), Frags: r.short()}, nil
+	case protonetquake.SVCClientData:
+		return r.clientData(), nil
+	case protonetquake.SVCStopSound:
+		return StopSound{Channel: r.short()}, nil
+	case protonetquake.SVCUpdateColors:
+		return UpdateColors{Slot: r.byte(), Colors: r.byte()}, nil
+	case protonetquake.SVCParticle:
+		return Particle{Origin: r.vec(), Direction: [3]int{r.char(), r.char(), r.char()}, Count: r.byte(), Color: r.byte()}, nil
+	case protonetquake.SVCDamage:
+		return Damage{Armor: r.byte(), Blood: r.byte(), From: r.vec()}, nil
+	case protonetquake.SVCSpawnStatic:
+		return SpawnStatic{r.baseline()}, nil
+	case protonetquake.SVCSpawnBaseline:
+		return SpawnBaseline{Num: r.short(), Entity: r.baseline()}, nil
+	case protonetquake.SVCTempEntity:
+		return r.tempEntity()
+	case protonetquake.SVCSetPause:
+		return SetPause{Paused: r.byte() != 0}, nil
+	case protonetquake.SVCSignOnNum:
+		return SignOnNum{Stage: r.byte()}, nil
+	case protonetquake.SVCCenterPrint:
+		return CenterPrint{Text: r.string()}, nil
+	case protonetquake.SVCKilledMonster:
+		return KilledMonster{}, nil
+	case protonetquake.SVCFoundSecret:
+		return FoundSecret{}, nil
+	case protonetquake.SVCSpawnStaticSound:
+		return SpawnStaticSound{Origin: r.vec(), Sound: r.byte(), Volume: r.byte(), Attenuation: r.byte()}, nil
+	case protonetquake.SVCIntermission:
+		return Intermission{}, nil
+	case protonetquake.SVCFinale:
+		return Finale{Text: r.string()}, nil
+	case protonetquake.SVCCDTrack:
+		return CDTrack{Track: r.byte(), Loop: r.byte()}, nil
+	case protonetquake.SVCSellScreen:
+		return SellScreen{}, nil
+	case protonetquake.SVCCutScene:
+		return CutScene{Text: r.string()}, nil
+	}
+	return nil, ErrBadMessage(fmt.Sprintf("svc %d", cmd))
+}
+
+func (r *reader) clientData() ClientData {
+	c := ClientData{Bits: r.short(), ViewHeight: 22}
+	if c.Bits&SUViewHeight != 0 {
+		c.ViewHeight = r.char()
+	}
+	if c.Bits&SUIdealPitch != 0 {
+		c.IdealPitch = r.char()
+	}
+	for i := 0; i < 3; i++ {
+		if c.Bits&(SUPunch1<<uint(i)) != 0 {
+			c.Punch[i] = r.char()
+		}
+		if c.Bits&(SUVelocity1<<uint(i)) != 0 {
+			c.Velocity[i] = r.char() * 16
+		}
+	}
+	// The items are always sent.
+	c.Items = r.long()
+	if c.Bits&SUWeaponFrame != 0 {
+		c.WeaponFrame = r.byte()
+	}
+	if c.Bits&SUArmor != 0 {
+		c.Armor = r.byte()
+	}
+	if c.Bits&SUWeapon != 0 {
+		c.Weapon = r.byte()
+	}
+	c.Health = r.short()
+	c.CurrentAmmo = r.byte()
+	for i := range c.Ammo {
+		c.Ammo[i] = r.byte()
+	}
+	c.ActiveWeapon = r.byte()
+	return c
+}
+
+func (r *reader) tempEntity() (Message, error) {
+	te := TempEntity{Type: byte(r.byte())}
+	switch te.Type {
+	case protonetquake.TESpike, protonetquake.TESuperSpike, protonetquake.TEGunshot,
+		protonetquake.TEExplosion, protonetquake.TETarExplosion, protonetquake.TEWizSpike,
+		protonetquake.TEKnigthSpike, protonetquake.TELavaSplash, protonetquake.TETeleport:
+		te.Origin = r.vec()
+	case protonetquake.TEExplosion2:
+		te.Origin = r.vec()
+		te.ColorStart, te.ColorLen = r.byte(), r.byte()
+	case protonetquake.TELightning1, protonetquake.TELightning2,
+		protonetquake.TELightning3, protonetquake.TEBeam:
+		te.Entity = r.short()
+		te.Origin, te.End = r.vec(), r.vec()
+	default:
+		return nil, ErrBadMessage(fmt.Sprintf("temp entity %d", te.Type))
+	}
+	return te, nil
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/matttproud/go-quake/qtype"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		data []byte
+		msgs []Message
+		err  error
+	}{
+		{
+			data: []byte("\x08hello\n\x00\x19\x02\x01"),
+			msgs: []Message{Print{Text: "hello\n"}, SignOnNum{Stage: 2}, Nop{}},
+		},
+		{
+			data: []byte("\x0b\x0f\x00\x00\x00\x04\x01e1m1\x00maps/e1m1.bsp\x00\x00weapons/r_exp3.wav\x00\x00"),
+			msgs: []Message{ServerInfo{
+				Protocol:   15,
+				MaxClients: 4,
+				GameType:   1,
+				Level:      "e1m1",
+				Models:     []string{"maps/e1m1.bsp"},
+				Sounds:     []string{"weapons/r_exp3.wav"},
+			}},
+		},
+		{
+			data: []byte("\x0e\x02\xfb\xff\x11\x02\x4f\x18\x01"),
+			msgs: []Message{UpdateFrags{Slot: 2, Frags: -5}, UpdateColors{Slot: 2, Colors: 0x4f}, SetPause{Paused: true}},
+		},
+		{
+			// An update of entity 3's frame and x origin.
+			data: []byte{0x80 | UOrigin1 | UFrame, 3, 7, 0x10, 0x00},
+			msgs: []Message{EntityUpdate{Bits: UOrigin1 | UFrame, Num: 3, Entity: Entity{Frame: 7, Origin: qtype.Vec3{2}}}},
+		},
+		{
+			// An update of entity 300's model and yaw, needing more bits.
+			data: []byte{0x80 | UMoreBits | UAngle2, (UModel | ULongEntity) >> 8, 0x2c, 0x01, 9, 64},
+			msgs: []Message{EntityUpdate{Bits: UMoreBits | UModel | UAngle2 | ULongEntity, Num: 300, Entity: Entity{Model: 9, Angles: qtype.Vec3{0, 90}}}},
+		},
+		{
+			data: []byte("\x17\x03\x08\x00\x10\x00\x18\x00"),
+			msgs: []Message{TempEntity{Type: 3, Origin: qtype.Vec3{1, 2, 3}}},
+		},
+		{
+			data: []byte("\x08unterminated"),
+			err:  ErrBadMessage("unterminated string"),
+		},
+		{
+			data: []byte("\x01\x03\x01"),
+			msgs: []Message{Nop{}},
+			err:  ErrBadMessage("truncated"),
+		},
+		{
+			data: []byte{0x7f},
+			err:  ErrBadMessage("svc 127"),
+		},
+	} {
+		msgs, err := Parse(test.data)
+		if got, want := msgs, test.msgs; !reflect.DeepEqual(got, want) {
+			t.Errorf("Parse(%q) = %#v, want = %#v", test.data, got, want)
+		}
+		if got, want := err, test.err; got != want {
+			t.Errorf("Parse(%q) err = %v, want = %v", test.data, got, want)
+		}
+	}
+}
+
+func TestEntityUpdateApply(t *testing.T) {
+	base := Entity{Model: 1, Frame: 2, Skin: 3, Origin: qtype.Vec3{8, 16, 24}, Angles: qtype.Vec3{0, 45, 0}}
+	u := EntityUpdate{Bits: UFrame | UOrigin2, Entity: Entity{Frame: 5, Origin: qtype.Vec3{0, -4, 0}}}
+	want := Entity{Model: 1, Frame: 5, Skin: 3, Origin: qtype.Vec3{8, -4, 24}, Angles: qtype.Vec3{0, 45, 0}}
+	if got := u.Apply(base); got != want {
+		t.Errorf("got = %+v, want = %+v", got, want)
+	}
+}
+
+func TestMoveEncode(t *testing.T) {
+	m := Move{Time: 1, Angles: qtype.Vec3{0, 90, 0}, Forward: 200, Side: -100, Buttons: 1, Impulse: 7}
+	want := []byte{3, 0, 0, 0x80, 0x3f, 0, 64, 0, 200, 0, 0x9c, 0xff, 0, 0, 1, 7}
+	if got := m.Encode(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v, want = %v", got, want)
+	}
+}
@@ -1,8 +0,0 @@
-package main
-
-func init() {
-	cvars.NewFloat("chase_back", 100)
-	cvars.NewFloat("chase_up", 16)
-	cvars.NewFloat("chase_right", 0)
-	cvars.NewFloat("chase_active", 0)
-}
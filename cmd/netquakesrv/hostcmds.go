@@ -1,41 +0,0 @@
-package main
-
-func init() {
-	commands.Add("status", noImpl)
-	commands.Add("quit", noImpl)
-	commands.Add("god", noImpl)
-	commands.Add("notarget", noImpl)
-	commands.Add("fly", noImpl)
-	commands.Add("map", noImpl)
-	commands.Add("restart", noImpl)
-	commands.Add("changelevel", noImpl)
-	commands.Add("changelevel2", noImpl)
-	commands.Add("connect", noImpl)
-	commands.Add("reconnect", noImpl)
-	commands.Add("name", noImpl)
-	commands.Add("noclip", noImpl)
-	commands.Add("version", noImpl)
-	commands.Add("please", noImpl)
-	commands.Add("say", noImpl)
-	commands.Add("say_team", noImpl)
-	commands.Add("tell", noImpl)
-	commands.Add("color", noImpl)
-	commands.Add("kill", noImpl)
-	commands.Add("pause", noImpl)
-	commands.Add("spawn", noImpl)
-	commands.Add("begin", noImpl)
-	commands.Add("prespawn", noImpl)
-	commands.Add("kick", noImpl)
-	commands.Add("ping", noImpl)
-	commands.Add("load", noImpl)
-	commands.Add("save", noImpl)
-	commands.Add("give", noImpl)
-	commands.Add("startdemos", noImpl)
-	commands.Add("demos", noImpl)
-	commands.Add("stopdemo", noImpl)
-	commands.Add("viewmodel", noImpl)
-	commands.Add("viewframe", noImpl)
-	commands.Add("viewnext", noImpl)
-	commands.Add("viewprev", noImpl)
-	commands.Add("mcache", noImpl)
-}
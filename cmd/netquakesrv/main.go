@@ -4,21 +4,33 @@ package main
 import (
 	"flag"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 
 	"golang.org/x/net/context"
 
-	"github.com/matttproud/go-quake/command"
-	"github.com/matttproud/go-quake/cvar"
-	"github.com/matttproud/go-quake/prog"
+	"github.com/matttproud/go-quake/impair"
+	"github.com/matttproud/go-quake/server"
 )
 
 var (
-	cvars    = cvar.New()
-	commands = command.New()
+	flagBaseDir    string
+	flagGame       string
+	flagRecord     bool
+	flagPort       int
+	flagListen     bool
+	flagMaxPlayers int
 
-	server *Server
+	// Each direction of every socket is impaired alike.
+	flagImpair     impair.Profile
+	flagImpairSeed int64
+
+	// impairedSockets counts the session sockets, each of which is
+	// impaired with a seed of its own.
+	impairedSockets int64
 )
 
 func main() {
@@ -33,48 +45,46 @@ func main() {
 	}
 	log.Println("[DONE] Starting inspection subsystems")
 	log.Println("Finding game assets ...")
-	assets, err := GamePath()
+	assets, err := server.GamePath(flagBaseDir, flagGame)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 	defer assets.Close()
 	log.Println("[DONE] Finding game assets")
-	log.Println("Preparing the game virtual machine ...")
-	progs, err := assets.Load("progs.dat")
+	log.Println("Beginning listening for new clients ...")
+	conn, err := server.Listen(flagPort)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	_, err = prog.Open(progs)
-	if err != nil {
-		log.Println(err)
-		return
+	log.Println("[DONE] Beginning listening for new clients ...")
+	log.Println("Preparing the server ...")
+	var listenSession func() (net.PacketConn, error)
+	if !flagImpair.Zero() {
+		log.Printf("Impairing the network: %+v", flagImpair)
+		conn = impair.Wrap(conn, flagImpair, flagImpair, flagImpairSeed)
+		listenSession = listenImpaired
 	}
-	log.Println("[DONE] Preparing the game virtual machine")
-	log.Println("Beginning listening for new clients ...")
-	conn, err := Listen()
+	srv, err := server.New(server.Config{
+		Conn:          conn,
+		ListenSession: listenSession,
+		Assets:        assets,
+		GameDir:       server.GameDir(flagBaseDir, flagGame),
+		MaxPlayers:    flagMaxPlayers,
+	})
 	if err != nil {
+		conn.Close()
 		log.Println(err)
 		return
 	}
-	log.Println("[DONE] Beginning listening for new clients ...")
+	defer srv.Close()
+	h := srv.Handler()
+	http.Handle("/api/", h)
+	http.Handle("/metrics", h)
+	log.Println("[DONE] Preparing the server")
 	log.Println("Running main loop ...")
-	sessions := make(SessionRegistry)
-	serverCancel := func() {
-		sessions.Close()
-		cancel()
-	}
-	server = &Server{
-		State:      Waiting,
-		Conn:       conn,
-		MaxPlayers: 1,
-		Sessions:   sessions,
-		closeSig:   make(chan struct{}),
-		Cancel:     serverCancel,
-	}
-	defer server.Close()
-	if err := server.Loop(ctx); err != nil {
+	if err := srv.Loop(ctx); err != nil {
 		log.Println(err)
 		return
 	}
@@ -100,6 +110,22 @@ func main() {
 //	return nil
 //}
 
+// listenImpaired opens a session socket as the server would, but impaired.
+func listenImpaired() (net.PacketConn, error) {
+	laddr, err := server.LocalAddr()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	// Wrap seeds the two directions with seed and seed+1, so the seeds of
+	// the sockets are two apart, following those of the control socket.
+	seed := flagImpairSeed + 2*atomic.AddInt64(&impairedSockets, 1)
+	return impair.Wrap(conn, flagImpair, flagImpair, seed), nil
+}
+
 func handleInterrupt(ctx context.Context, cancel func()) {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt, os.Kill)
@@ -110,3 +136,19 @@ func handleInterrupt(ctx context.Context, cancel func()) {
 		cancel()
 	}
 }
+
+func init() {
+	flag.StringVar(&flagBaseDir, "basedir", ".", "the directory that contains id1 directory")
+	flag.StringVar(&flagGame, "game", "", "an alternative game directory")
+	flag.BoolVar(&flagRecord, "record", false, "whether to record a demo")
+	flag.IntVar(&flagPort, "port", server.DefaultPort, "serving port")
+	flag.BoolVar(&flagListen, "listen", false, "whether to listen for connections")
+	flag.IntVar(&flagMaxPlayers, "maxplayers", 8, "how many players may be connected at once, from 1 to 8")
+	flag.DurationVar(&flagImpair.Latency, "impair-latency", 0, "latency added to each datagram, for testing")
+	flag.DurationVar(&flagImpair.Jitter, "impair-jitter", 0, "greatest random deviation from -impair-latency")
+	flag.Float64Var(&flagImpair.Loss, "impair-loss", 0, "probability that a datagram is lost")
+	flag.Float64Var(&flagImpair.Duplicate, "impair-dup", 0, "probability that a datagram is duplicated")
+	flag.Float64Var(&flagImpair.Reorder, "impair-reorder", 0, "probability that a datagram is reordered")
+	flag.IntVar(&flagImpair.Rate, "impair-rate", 0, "bandwidth of each socket in bytes per second, or 0 for no limit")
+	flag.Int64Var(&flagImpairSeed, "impair-seed", 1, "seed of the random impairments")
+}
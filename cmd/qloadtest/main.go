@@ -0,0 +1,238 @@
+// qloadtest drives synthetic players against a netquakesrv to measure how it
+// holds up under load.
+//
+// Each player connects, completes the signon and then moves about at random
+// at the rate of a real client.  Once every player is in the game, the load
+// is held for -duration, after which the tool reports the connect latency,
+// the reliable resend rate, the bandwidth of each player and, when the
+// server's metrics are reachable, how its frame time compares with that of
+// the idle server.
+//
+// The server admits at most -maxplayers players, eight by default; any more
+// are refused as the server is full.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/matttproud/go-quake/client"
+	"github.com/matttproud/go-quake/proto/protonetquake"
+	"github.com/matttproud/go-quake/qtype"
+	"github.com/matttproud/go-quake/slist"
+)
+
+var (
+	addr           string
+	metricsURL     string
+	clients        int
+	duration       time.Duration
+	ramp           time.Duration
+	rate           float64
+	connectTimeout time.Duration
+	baseline       time.Duration
+	seed           int64
+)
+
+// player is the outcome of one synthetic client.
+type player struct {
+	connect time.Duration // until the server accepted
+	signon  time.Duration // until the client began
+	played  time.Duration
+	stats   client.Stats
+	err     error
+}
+
+func main() {
+	flag.Parse()
+	if clients < 1 || rate <= 0 {
+		log.Println("usage: qloadtest [-addr host:port] [-clients n] [-rate moves/s] [-duration d]")
+		os.Exit(2)
+	}
+	raddr, err := slist.Resolve(addr, protonetquake.DefaultPort)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go handleInterrupt(ctx, cancel)
+
+	var idle frameWindow
+	if metricsURL != "" {
+		if idle, err = sampleWindow(ctx, metricsURL, func() { sleep(ctx, baseline) }); err != nil {
+			log.Printf("Not reporting server metrics: %v", err)
+			metricsURL = ""
+		}
+	}
+
+	log.Printf("Connecting %d players to %v ...", clients, raddr)
+	play, stop := context.WithCancel(ctx)
+	defer stop()
+	var (
+		results = make([]player, clients)
+		joined  sync.WaitGroup
+		done    sync.WaitGroup
+	)
+	for i := range results {
+		joined.Add(1)
+		done.Add(1)
+		go func(i int) {
+			defer done.Done()
+			rng := rand.New(rand.NewSource(seed + int64(i)))
+			results[i] = run(play, i, raddr, rng, joined.Done)
+		}(i)
+		sleep(ctx, ramp)
+	}
+	joined.Wait()
+	log.Printf("[DONE] Connecting %d players", clients)
+
+	var loaded frameWindow
+	hold := func() { sleep(ctx, duration) }
+	log.Printf("Holding the load for %v ...", duration)
+	if metricsURL != "" {
+		if loaded, err = sampleWindow(ctx, metricsURL, hold); err != nil {
+			log.Printf("Not reporting server metrics: %v", err)
+			metricsURL = ""
+		}
+	} else {
+		hold()
+	}
+	stop()
+	done.Wait()
+	log.Printf("[DONE] Holding the load")
+
+	r := summarize(results)
+	if metricsURL != "" {
+		r.idle, r.loaded = &idle, &loaded
+	}
+	r.write(os.Stdout)
+}
+
+// run plays one client until ctx ends, calling joined once it is in the
+// game or has failed to get there.
+func run(ctx context.Context, id int, addr net.Addr, rng *rand.Rand, joined func()) (p player) {
+	var once sync.Once
+	defer once.Do(joined)
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		p.err = err
+		return p
+	}
+	defer conn.Close()
+	start := time.Now()
+	cctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	c, err := client.Connect(cctx, conn, addr)
+	if err != nil {
+		p.err = err
+		return p
+	}
+	p.connect = time.Since(start)
+	if err := c.SignOn(cctx, fmt.Sprintf("bot%d", id), rng.Intn(14)<<4|rng.Intn(14)); err != nil {
+		p.err = err
+		return p
+	}
+	p.signon = time.Since(start)
+	once.Do(joined)
+
+	start = time.Now()
+	defer func() {
+		p.played = time.Since(start)
+		p.stats = c.Stats
+	}()
+	var (
+		w    walker
+		tick = time.Duration(float64(time.Second) / rate)
+		next = time.Now()
+	)
+	for ctx.Err() == nil {
+		if err := c.Move(w.step(rng, c.State.Time)); err != nil {
+			p.err = err
+			return p
+		}
+		if next = next.Add(tick); time.Until(next) < -tick {
+			// Fall behind rather than send a burst of moves.
+			next = time.Now().Add(tick)
+		}
+		rctx, cancel := context.WithDeadline(ctx, next)
+		for rctx.Err() == nil {
+			if _, err := c.Read(rctx); err != nil && rctx.Err() == nil {
+				cancel()
+				p.err = err
+				return p
+			}
+		}
+		cancel()
+	}
+	c.Disconnect()
+	return p
+}
+
+// walker wanders about as a player might: it holds a course for a while,
+// turns gradually and now and then jumps, fires or changes weapon.
+type walker struct {
+	angles        qtype.Vec3
+	forward, side int16
+	hold          int
+}
+
+func (w *walker) step(rng *rand.Rand, now float32) client.Move {
+	if w.hold--; w.hold <= 0 {
+		w.forward = []int16{-200, 0, 200, 200, 400}[rng.Intn(5)]
+		w.side = []int16{-350, 0, 0, 350}[rng.Intn(4)]
+		w.hold = 10 + rng.Intn(50)
+	}
+	w.angles[0] = qtype.Float(math.Max(-70, math.Min(80, float64(w.angles[0])+rng.NormFloat64())))
+	w.angles[1] = qtype.Float(math.Mod(float64(w.angles[1])+rng.NormFloat64()*5+360, 360))
+	m := client.Move{Time: now, Angles: w.angles, Forward: w.forward, Side: w.side}
+	switch n := rng.Intn(200); {
+	case n < 20:
+		m.Buttons |= 1 // attack
+	case n < 22:
+		m.Buttons |= 2 // jump
+	case n == 22:
+		m.Impulse = byte(1 + rng.Intn(8))
+	}
+	return m
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+func handleInterrupt(ctx context.Context, cancel func()) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	select {
+	case <-ctx.Done():
+	case sig := <-sigCh:
+		log.Printf("Received %v; stopping ...", sig)
+		cancel()
+	}
+}
+
+func init() {
+	flag.StringVar(&addr, "addr", "localhost", "address of the server")
+	flag.StringVar(&metricsURL, "metrics", "http://localhost:8081/metrics", "the server's metrics, or empty to skip them")
+	flag.IntVar(&clients, "clients", 8, "how many players to connect")
+	flag.DurationVar(&duration, "duration", time.Minute, "how long to hold the load once all players have joined")
+	flag.DurationVar(&ramp, "ramp", 100*time.Millisecond, "delay between successive connections")
+	flag.Float64Var(&rate, "rate", 30, "moves each player sends per second")
+	flag.DurationVar(&connectTimeout, "connect-timeout", 10*time.Second, "how long a player may take to join")
+	flag.DurationVar(&baseline, "baseline", 3*time.Second, "how long to sample the idle server's frame time")
+	flag.Int64Var(&seed, "seed", 1, "seed of the players' random movement")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io"
+	"log"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/matttproud/go-quake/server"
+)
+
+// TestRun plays as many players as netquakesrv admits by default.
+func TestRun(t *testing.T) {
+	ctrl, err := server.Listen(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := server.New(server.Config{
+		Conn:       ctrl,
+		Logger:     log.New(io.Discard, "", 0),
+		Console:    io.Discard,
+		MaxPlayers: 8,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Loop(context.Background())
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		players = make([]player, clients)
+		joined  sync.WaitGroup
+		done    sync.WaitGroup
+	)
+	for i := range players {
+		joined.Add(1)
+		done.Add(1)
+		go func(i int) {
+			defer done.Done()
+			players[i] = run(ctx, i, ctrl.LocalAddr(), rand.New(rand.NewSource(int64(i))), joined.Done)
+		}(i)
+		sleep(ctx, ramp)
+	}
+	joined.Wait()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	done.Wait()
+	r := summarize(players)
+	if r.joined != clients || r.failed != 0 {
+		t.Errorf("%d joined, %d failed: %v", r.joined, r.failed, r.errors)
+	}
+}
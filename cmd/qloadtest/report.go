@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// scrape is the part of the server's metrics that the report uses.
+type scrape struct {
+	frameBuckets map[float64]float64 // cumulative counts by upper bound
+	frameSum     float64
+	frameCount   float64
+	resends      float64
+}
+
+func parseMetrics(r io.Reader) (scrape, error) {
+	s := scrape{frameBuckets: make(map[float64]float64)}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		if i == -1 {
+			continue
+		}
+		name, val := line[:i], line[i+1:]
+		v, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return s, fmt.Errorf("bad sample %q: %v", line, err)
+		}
+		switch {
+		case name == "quake_host_frame_seconds_sum":
+			s.frameSum = v
+		case name == "quake_host_frame_seconds_count":
+			s.frameCount = v
+		case name == "quake_reliable_resends_total":
+			s.resends = v
+		case strings.HasPrefix(name, `quake_host_frame_seconds_bucket{le="`):
+			le, err := strconv.ParseFloat(strings.TrimSuffix(name[len(`quake_host_frame_seconds_bucket{le="`):], `"}`), 64)
+			if err != nil {
+				return s, fmt.Errorf("bad bucket %q: %v", line, err)
+			}
+			s.frameBuckets[le] = v
+		}
+	}
+	return s, sc.Err()
+}
+
+func fetchMetrics(ctx context.Context, url string) (scrape, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return scrape{}, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return scrape{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return scrape{}, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return parseMetrics(resp.Body)
+}
+
+// frameWindow is what the server's metrics say of the frames run over a
+// period.
+type frameWindow struct {
+	frames  float64
+	mean    time.Duration
+	p95     float64 // upper bound of the bucket that holds the 95th percentile
+	resends float64
+	elapsed time.Duration
+}
+
+// sampleWindow scrapes the metrics on either side of fn.
+func sampleWindow(ctx context.Context, url string, fn func()) (frameWindow, error) {
+	before, err := fetchMetrics(ctx, url)
+	if err != nil {
+		return frameWindow{}, err
+	}
+	start := time.Now()
+	fn()
+	elapsed := time.Since(start)
+	after, err := fetchMetrics(context.Background(), url)
+	if err != nil {
+		return frameWindow{}, err
+	}
+	return diff(before, after, elapsed), nil
+}
+
+func diff(before, after scrape, elapsed time.Duration) frameWindow {
+	w := frameWindow{
+		frames:  after.frameCount - before.frameCount,
+		resends: after.resends - before.resends,
+		elapsed: elapsed,
+		p95:     math.Inf(1),
+	}
+	if w.frames <= 0 {
+		return w
+	}
+	w.mean = time.Duration((after.frameSum - before.frameSum) / w.frames * float64(time.Second))
+	var bounds []float64
+	for le := range after.frameBuckets {
+		bounds = append(bounds, le)
+	}
+	sort.Float64s(bounds)
+	for _, le := range bounds {
+		if after.frameBuckets[le]-before.frameBuckets[le] >= 0.95*w.frames {
+			w.p95 = le
+			break
+		}
+	}
+	return w
+}
+
+type report struct {
+	joined, failed    int
+	errors            map[string]int
+	connect, signon   []time.Duration
+	resends, reliable uint64
+	stale             uint64
+	bpsIn, bpsOut     []float64 // bytes per second of each player
+	idle, loaded      *frameWindow
+}
+
+func summarize(players []player) report {
+	r := report{errors: make(map[string]int)}
+	for _, p := range players {
+		if p.err != nil {
+			r.errors[p.err.Error()]++
+		}
+		if p.signon == 0 {
+			r.failed++
+			continue
+		}
+		r.joined++
+		r.connect = append(r.connect, p.connect)
+		r.signon = append(r.signon, p.signon)
+		r.resends += p.stats.Resends
+		r.reliable += p.stats.ReliableSent
+		r.stale += p.stats.Stale
+		if secs := p.played.Seconds(); secs > 0 {
+			r.bpsIn = append(r.bpsIn, float64(p.stats.BytesIn)/secs)
+			r.bpsOut = append(r.bpsOut, float64(p.stats.BytesOut)/secs)
+		}
+	}
+	return r
+}
+
+// percentile returns the pth percentile of the sorted ds.
+func percentile(ds []time.Duration, p float64) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	return ds[int(math.Ceil(p*float64(len(ds))))-1]
+}
+
+func writeLatency(w io.Writer, name string, ds []time.Duration) {
+	if len(ds) == 0 {
+		return
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	fmt.Fprintf(w, "%-16s min %-10v p50 %-10v p95 %-10v max %v\n", name,
+		ds[0].Round(time.Microsecond), percentile(ds, 0.5).Round(time.Microsecond),
+		percentile(ds, 0.95).Round(time.Microsecond), ds[len(ds)-1].Round(time.Microsecond))
+}
+
+func writeRate(w io.Writer, name string, vs []float64) {
+	if len(vs) == 0 {
+		return
+	}
+	var sum, max float64
+	for _, v := range vs {
+		sum += v
+		max = math.Max(max, v)
+	}
+	fmt.Fprintf(w, "%-16s mean %.0f B/s, max %.0f B/s\n", name, sum/float64(len(vs)), max)
+}
+
+func (r report) write(w io.Writer) {
+	fmt.Fprintf(w, "players          %d joined, %d failed\n", r.joined, r.failed)
+	for msg, n := range r.errors {
+		fmt.Fprintf(w, "  %dx %s\n", n, msg)
+	}
+	writeLatency(w, "connect", r.connect)
+	writeLatency(w, "signon", r.signon)
+	var rate float64
+	if r.reliable > 0 {
+		rate = float64(r.resends) / float64(r.reliable)
+	}
+	fmt.Fprintf(w, "client resends   %d of %d reliable datagrams (%.2f%%), %d stale datagrams\n",
+		r.resends, r.reliable, 100*rate, r.stale)
+	writeRate(w, "bandwidth in", r.bpsIn)
+	writeRate(w, "bandwidth out", r.bpsOut)
+	if r.idle == nil || r.loaded == nil {
+		return
+	}
+	for _, fw := range []struct {
+		name string
+		w    *frameWindow
+	}{{"idle frames", r.idle}, {"loaded frames", r.loaded}} {
+		fmt.Fprintf(w, "%-16s %.0f frames, mean %v, p95 <= %gs\n", fw.name, fw.w.frames, fw.w.mean, fw.w.p95)
+	}
+	if r.idle.mean > 0 {
+		fmt.Fprintf(w, "frame time       %.2fx the idle server's\n", float64(r.loaded.mean)/float64(r.idle.mean))
+	}
+	fmt.Fprintf(w, "server resends   %.0f while loaded (%.1f/s)\n", r.loaded.resends, r.loaded.resends/r.loaded.elapsed.Seconds())
+}
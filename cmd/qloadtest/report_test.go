@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrameWindow(t *testing.T) {
+	before, err := parseMetrics(strings.NewReader(`# TYPE quake_host_frame_seconds histogram
+quake_host_frame_seconds_bucket{le="0.001"} 90
+quake_host_frame_seconds_bucket{le="0.01"} 100
+quake_host_frame_seconds_bucket{le="+Inf"} 100
+quake_host_frame_seconds_sum 0.2
+quake_host_frame_seconds_count 100
+quake_reliable_resends_total 3
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := parseMetrics(strings.NewReader(`quake_host_frame_seconds_bucket{le="0.001"} 100
+quake_host_frame_seconds_bucket{le="0.01"} 196
+quake_host_frame_seconds_bucket{le="+Inf"} 200
+quake_host_frame_seconds_sum 1.2
+quake_host_frame_seconds_count 200
+quake_reliable_resends_total 13
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := diff(before, after, 10*time.Second)
+	want := frameWindow{frames: 100, mean: 10 * time.Millisecond, p95: 0.01, resends: 10, elapsed: 10 * time.Second}
+	if got != want {
+		t.Errorf("got = %+v, want = %+v", got, want)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	ds := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	for _, test := range []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0.5, 5},
+		{0.95, 10},
+		{0.1, 1},
+	} {
+		if got := percentile(ds, test.p); got != test.want {
+			t.Errorf("percentile(%v) = %v, want = %v", test.p, got, test.want)
+		}
+	}
+}
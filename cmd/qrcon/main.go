@@ -0,0 +1,64 @@
+// qrcon runs console commands on a netquakesrv through its remote console.
+//
+// The password is read from the QRCON_PASSWORD environment variable unless
+// given with -password, so that it needn't appear in the process list.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+	"github.com/matttproud/go-quake/rcon"
+	"github.com/matttproud/go-quake/slist"
+)
+
+var (
+	addr     string
+	password string
+	timeout  time.Duration
+)
+
+// run runs the command and returns the process's exit code, so that its
+// deferred calls finish before main exits.
+func run() int {
+	flag.Parse()
+	if password == "" {
+		password = os.Getenv("QRCON_PASSWORD")
+	}
+	if flag.NArg() == 0 {
+		log.Println("usage: qrcon [-addr host:port] [-password secret] command ...")
+		return 2
+	}
+	raddr, err := slist.Resolve(addr, protonetquake.DefaultPort)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer conn.Close()
+	out, err := rcon.Exec(conn, raddr, password, strings.Join(flag.Args(), " "), timeout)
+	fmt.Print(out)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+func main() { os.Exit(run()) }
+
+func init() {
+	flag.StringVar(&addr, "addr", "localhost", "address of the server")
+	flag.StringVar(&password, "password", "", "the server's rcon_password")
+	flag.DurationVar(&timeout, "timeout", 3*time.Second, "how long to await the reply")
+}
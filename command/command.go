@@ -1,29 +1,72 @@
 // Package command provides console command bindings.
 package command
 
-import "fmt"
-
-type Registry map[string]Func
+type Registry map[string]*Command
 
 func New() Registry { return make(Registry) }
 
 type ErrAlreadyRegistered string
 
 func (e ErrAlreadyRegistered) Error() string {
-	return fmt.Sprintf("command: %v is already registered", e)
+	return "command: " + string(e) + " is already registered"
 }
 
 type Func func(args ...string) error
 
-func (r Registry) Add(name string, fn Func) error {
+// Source identifies where a command came from, as cmd_source does.
+type Source int
+
+const (
+	// SrcCommand is the local console, configuration files and remote
+	// administration.
+	SrcCommand Source = iota
+	// SrcClient is the text of a connected client's clc_stringcmd.
+	SrcClient
+)
+
+type Command struct {
+	Func Func
+	opts options
+}
+
+type options struct {
+	ClientCallable bool
+}
+
+func (o *options) Apply(os ...Option) {
+	for _, opt := range os {
+		opt(o)
+	}
+}
+
+type Option func(*options)
+
+// ClientCallable permits clients to run the command.
+var ClientCallable Option = func(o *options) { o.ClientCallable = true }
+
+func (r Registry) Add(name string, fn Func, os ...Option) error {
 	if _, ok := r[name]; ok {
 		return ErrAlreadyRegistered(name)
 	}
-	r[name] = fn
+	cmd := &Command{Func: fn}
+	cmd.opts.Apply(os...)
+	r[name] = cmd
 	return nil
 }
 
 func (r Registry) Find(name string) (fn Func, ok bool) {
-	fn, ok = r[name]
-	return fn, ok
+	cmd, ok := r[name]
+	if !ok {
+		return nil, false
+	}
+	return cmd.Func, true
+}
+
+// FindFrom finds the command only if src may run it.
+func (r Registry) FindFrom(name string, src Source) (fn Func, ok bool) {
+	cmd, ok := r[name]
+	if !ok || src == SrcClient && !cmd.opts.ClientCallable {
+		return nil, false
+	}
+	return cmd.Func, true
 }
@@ -0,0 +1,29 @@
+package command
+
+import "testing"
+
+func TestFindFrom(t *testing.T) {
+	r := New()
+	nop := func(args ...string) error { return nil }
+	r.Add("quit", nop)
+	r.Add("say", nop, ClientCallable)
+	for _, test := range []struct {
+		name string
+		src  Source
+		want bool
+	}{
+		{"quit", SrcCommand, true},
+		{"quit", SrcClient, false},
+		{"say", SrcCommand, true},
+		{"say", SrcClient, true},
+		{"missing", SrcCommand, false},
+		{"missing", SrcClient, false},
+	} {
+		if _, got := r.FindFrom(test.name, test.src); got != test.want {
+			t.Errorf("r.FindFrom(%q, %v) = %v, want = %v", test.name, test.src, got, test.want)
+		}
+	}
+	if err := r.Add("say", nop); err == nil {
+		t.Error("duplicate registration succeeded")
+	}
+}
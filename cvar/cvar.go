@@ -1,14 +1,40 @@
 // Package cvar provides console variable facilities.
 package cvar
 
-import "fmt"
+import (
+	"sort"
+	"strconv"
+)
 
 type Registry map[string]interface{}
 
 func New() Registry { return make(Registry) }
 
+// Var is the behavior common to all console variables.
+type Var interface {
+	String() string
+	Parse(string) error
+	ServerSide() bool
+	Secret() bool
+}
+
+func (r Registry) Lookup(name string) (Var, bool) {
+	v, ok := r[name].(Var)
+	return v, ok
+}
+
+// Names returns the names of all registered variables in sorted order.
+func (r Registry) Names() []string {
+	names := make([]string, 0, len(r))
+	for n := range r {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
 type options struct {
-	Saved, ServerSide bool
+	Saved, ServerSide, Secret bool
 }
 
 func (o *options) Apply(os ...Option) {
@@ -25,6 +51,16 @@ type String struct {
 func (s *String) Get() string  { return s.val }
 func (s *String) Set(v string) { s.val = v }
 
+func (s *String) String() string { return s.val }
+
+func (s *String) ServerSide() bool { return s.opts.ServerSide }
+func (s *String) Secret() bool     { return s.opts.Secret }
+
+func (s *String) Parse(v string) error {
+	s.val = v
+	return nil
+}
+
 func (r Registry) NewString(name, def string, os ...Option) (*String, error) {
 	if _, ok := r[name]; ok {
 		return nil, ErrAlreadyRegistered(name)
@@ -43,6 +79,20 @@ type Float struct {
 func (f *Float) Get() float32  { return f.val }
 func (f *Float) Set(v float32) { f.val = v }
 
+func (f *Float) String() string { return strconv.FormatFloat(float64(f.val), 'g', -1, 32) }
+
+func (f *Float) ServerSide() bool { return f.opts.ServerSide }
+func (f *Float) Secret() bool     { return f.opts.Secret }
+
+func (f *Float) Parse(v string) error {
+	n, err := strconv.ParseFloat(v, 32)
+	if err != nil {
+		return err
+	}
+	f.val = float32(n)
+	return nil
+}
+
 func (r Registry) NewFloat(name string, def float32, os ...Option) (*Float, error) {
 	if _, ok := r[name]; ok {
 		return nil, ErrAlreadyRegistered(name)
@@ -58,8 +108,12 @@ type Option func(*options)
 var Saved Option = func(o *options) { o.Saved = true }
 var ServerSide Option = func(o *options) { o.ServerSide = true }
 
+// Secret marks a variable, such as a password, whose value must not be shown
+// to those who inspect the server from outside.
+var Secret Option = func(o *options) { o.Secret = true }
+
 type ErrAlreadyRegistered string
 
 func (e ErrAlreadyRegistered) Error() string {
-	return fmt.Sprintf("command: %v is already registered", e)
+	return "cvar: " + string(e) + " is already registered"
 }
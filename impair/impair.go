@@ -0,0 +1,240 @@
+// Package impair degrades a net.PacketConn in the manner of Linux's netem, so
+// that the behaviour of the datagram protocol over a poor network may be
+// reproduced on a single machine: datagrams may be delayed, jittered, lost,
+// duplicated, reordered and held to a bandwidth.
+//
+// Jitter alone may reorder datagrams, as it does with netem.
+package impair
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Profile describes the impairment of one direction of traffic.
+type Profile struct {
+	Latency time.Duration // added to every datagram
+	Jitter  time.Duration // greatest random deviation from Latency
+	// Loss, Duplicate and Reorder are the probabilities, from 0 to 1, that a
+	// datagram is dropped, sent twice or held back behind its successors.
+	Loss      float64
+	Duplicate float64
+	Reorder   float64
+	// ReorderDelay is how long a reordered datagram is held back beyond its
+	// latency.  It is DefaultReorderDelay if zero.
+	ReorderDelay time.Duration
+	// Rate is the bandwidth in bytes per second, or 0 for no limit.  A
+	// datagram that would queue for longer than MaxBacklog is dropped.
+	Rate int
+}
+
+const (
+	DefaultReorderDelay = 10 * time.Millisecond
+	MaxBacklog          = time.Second
+	queueLen            = 256
+)
+
+// Zero reports whether p impairs nothing.
+func (p Profile) Zero() bool { return p == Profile{} }
+
+var ErrClosed = errors.New("impair: use of closed connection")
+
+type errTimeout struct{}
+
+func (errTimeout) Error() string   { return "impair: i/o timeout" }
+func (errTimeout) Timeout() bool   { return true }
+func (errTimeout) Temporary() bool { return true }
+
+// link schedules the datagrams of one direction.
+type link struct {
+	p         Profile
+	mtx       sync.Mutex
+	rng       *rand.Rand
+	busyUntil time.Time // when the link finishes sending what it has queued
+}
+
+func newLink(p Profile, seed int64) *link {
+	return &link{p: p, rng: rand.New(rand.NewSource(seed))}
+}
+
+// send arranges for deliver to be called with data as p dictates.
+func (l *link) send(data []byte, deliver func([]byte)) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.rng.Float64() < l.p.Loss {
+		return
+	}
+	copies := 1
+	if l.rng.Float64() < l.p.Duplicate {
+		copies = 2
+	}
+	now := time.Now()
+	var queued time.Duration
+	if l.p.Rate > 0 {
+		if l.busyUntil.Before(now) {
+			l.busyUntil = now
+		}
+		if l.busyUntil.Sub(now) > MaxBacklog {
+			return
+		}
+		l.busyUntil = l.busyUntil.Add(time.Duration(len(data)) * time.Second / time.Duration(l.p.Rate))
+		queued = l.busyUntil.Sub(now)
+	}
+	data = append([]byte(nil), data...)
+	for i := 0; i < copies; i++ {
+		delay := queued + l.p.Latency
+		if l.p.Jitter > 0 {
+			delay += time.Duration(l.rng.Int63n(int64(2*l.p.Jitter)+1)) - l.p.Jitter
+		}
+		if l.rng.Float64() < l.p.Reorder {
+			if l.p.ReorderDelay > 0 {
+				delay += l.p.ReorderDelay
+			} else {
+				delay += DefaultReorderDelay
+			}
+		}
+		if delay <= 0 {
+			deliver(data)
+			continue
+		}
+		time.AfterFunc(delay, func() { deliver(data) })
+	}
+}
+
+type datagram struct {
+	data []byte
+	from net.Addr
+}
+
+// Conn is a net.PacketConn whose traffic is impaired.
+type Conn struct {
+	net.PacketConn
+	in, out *link
+
+	// When inbound traffic is impaired, a reader moves datagrams from the
+	// wrapped conn to the queue through in.
+	queue     chan datagram
+	readErr   error
+	closed    chan struct{}
+	closeOnce sync.Once
+	mtx       sync.Mutex
+	deadline  time.Time
+}
+
+// Wrap impairs what conn receives as in describes and what it sends as out
+// does.  The seed makes the random choices repeatable.
+func Wrap(conn net.PacketConn, in, out Profile, seed int64) *Conn {
+	c := &Conn{
+		PacketConn: conn,
+		out:        newLink(out, seed),
+		closed:     make(chan struct{}),
+	}
+	if !in.Zero() {
+		c.in = newLink(in, seed+1)
+		c.queue = make(chan datagram, queueLen)
+		go c.read()
+	}
+	return c
+}
+
+func (c *Conn) read() {
+	var buf [64 << 10]byte
+	for {
+		n, from, err := c.PacketConn.ReadFrom(buf[:])
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			c.mtx.Lock()
+			c.readErr = err
+			c.mtx.Unlock()
+			c.Close()
+			return
+		}
+		c.in.send(buf[:n], func(data []byte) {
+			select {
+			case c.queue <- datagram{data: data, from: from}:
+			default:
+			}
+		})
+	}
+}
+
+func (c *Conn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, ErrClosed
+	default:
+	}
+	c.out.send(p, func(data []byte) {
+		select {
+		case <-c.closed:
+		default:
+			c.PacketConn.WriteTo(data, addr)
+		}
+	})
+	return len(p), nil
+}
+
+func (c *Conn) ReadFrom(p []byte) (int, net.Addr, error) {
+	if c.in == nil {
+		return c.PacketConn.ReadFrom(p)
+	}
+	c.mtx.Lock()
+	dl := c.deadline
+	c.mtx.Unlock()
+	var timeout <-chan time.Time
+	if !dl.IsZero() {
+		d := time.Until(dl)
+		if d <= 0 {
+			return 0, nil, errTimeout{}
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case d := <-c.queue:
+		return copy(p, d.data), d.from, nil
+	case <-c.closed:
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		if c.readErr != nil {
+			return 0, nil, c.readErr
+		}
+		return 0, nil, ErrClosed
+	case <-timeout:
+		return 0, nil, errTimeout{}
+	}
+}
+
+func (c *Conn) Close() error {
+	err := ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.PacketConn.Close()
+	})
+	return err
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.PacketConn.SetWriteDeadline(t)
+}
+
+// SetReadDeadline applies to reads that begin after it is called when
+// inbound traffic is impaired.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	if c.in == nil {
+		return c.PacketConn.SetReadDeadline(t)
+	}
+	c.mtx.Lock()
+	c.deadline = t
+	c.mtx.Unlock()
+	return nil
+}
@@ -0,0 +1,196 @@
+package impair
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/matttproud/go-quake/client"
+	"github.com/matttproud/go-quake/memnet"
+	"github.com/matttproud/go-quake/server"
+)
+
+// pair returns a conn impaired by out and the conn to which it sends.
+func pair(t *testing.T, out Profile) (*Conn, net.PacketConn) {
+	var nw memnet.Network
+	a, err := nw.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := nw.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Wrap(a, Profile{}, out, 1), b
+}
+
+// receive reads datagrams from conn until none arrives for wait.
+func receive(conn net.PacketConn, wait time.Duration) []string {
+	var (
+		out []string
+		buf [2048]byte
+	)
+	for {
+		conn.SetReadDeadline(time.Now().Add(wait))
+		n, _, err := conn.ReadFrom(buf[:])
+		if err != nil {
+			return out
+		}
+		out = append(out, string(buf[:n]))
+	}
+}
+
+func TestProfile(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		p    Profile
+		sent int
+		want int
+	}{
+		{"none", Profile{}, 10, 10},
+		{"loss", Profile{Loss: 1}, 10, 0},
+		{"duplicate", Profile{Duplicate: 1}, 10, 20},
+		{"jitter", Profile{Latency: 5 * time.Millisecond, Jitter: 5 * time.Millisecond}, 10, 10},
+	} {
+		a, b := pair(t, test.p)
+		for i := 0; i < test.sent; i++ {
+			if _, err := a.WriteTo([]byte(fmt.Sprint(i)), b.LocalAddr()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := receive(b, 50*time.Millisecond); len(got) != test.want {
+			t.Errorf("%s: received %v, want %d datagrams", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLatency(t *testing.T) {
+	a, b := pair(t, Profile{Latency: 30 * time.Millisecond})
+	start := time.Now()
+	a.WriteTo([]byte("x"), b.LocalAddr())
+	if got := receive(b, 100*time.Millisecond); len(got) != 1 {
+		t.Fatalf("received %v", got)
+	}
+	if took := time.Since(start); took < 30*time.Millisecond {
+		t.Errorf("arrived after %v, want >= 30ms", took)
+	}
+}
+
+func TestRate(t *testing.T) {
+	a, b := pair(t, Profile{Rate: 10000})
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		a.WriteTo(make([]byte, 100), b.LocalAddr())
+	}
+	if got := receive(b, 100*time.Millisecond); len(got) != 10 {
+		t.Fatalf("received %d datagrams, want 10", len(got))
+	}
+	if took := time.Since(start); took < 100*time.Millisecond {
+		t.Errorf("1000 bytes at 10000 B/s took %v, want >= 100ms", took)
+	}
+}
+
+func TestReorder(t *testing.T) {
+	a, b := pair(t, Profile{Reorder: 0.3})
+	var sent []string
+	for i := 0; i < 20; i++ {
+		sent = append(sent, fmt.Sprint(i))
+		a.WriteTo([]byte(sent[i]), b.LocalAddr())
+	}
+	got := receive(b, 50*time.Millisecond)
+	if len(got) != len(sent) {
+		t.Fatalf("received %v, want %v", got, sent)
+	}
+	if strings.Join(got, " ") == strings.Join(sent, " ") {
+		t.Errorf("received %v in order", got)
+	}
+}
+
+func TestInbound(t *testing.T) {
+	var nw memnet.Network
+	a, err := nw.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := nw.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := Wrap(b, Profile{Duplicate: 1}, Profile{}, 1)
+	defer in.Close()
+	a.WriteTo([]byte("x"), in.LocalAddr())
+	if got, want := receive(in, 50*time.Millisecond), []string{"x", "x"}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("received %v, want %v", got, want)
+	}
+	in.Close()
+	if _, _, err := in.ReadFrom(make([]byte, 1)); err == nil {
+		t.Error("read from closed conn")
+	}
+}
+
+// TestUnreliableDrops exercises the server's handling of unreliable
+// datagrams that arrive out of order or not at all.
+func TestUnreliableDrops(t *testing.T) {
+	var nw memnet.Network
+	ctrl, err := nw.Listen("127.0.0.1:26000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := server.New(server.Config{
+		Conn:          ctrl,
+		ListenSession: nw.ListenPacket("127.0.0.1:0"),
+		Logger:        log.New(io.Discard, "", 0),
+		Console:       io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Loop(context.Background())
+	defer srv.Close()
+	conn, err := nw.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := client.Connect(ctx, conn, ctrl.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SignOn(ctx, "Ranger", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the moves that follow the signon are impaired.
+	c.Conn = Wrap(conn, Profile{}, Profile{Loss: 0.1, Reorder: 0.3, ReorderDelay: 5 * time.Millisecond}, 1)
+	for i := 0; i < 100; i++ {
+		if err := c.Move(client.Move{Forward: 200}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for _, reason := range []string{"stale", "missed"} {
+		sample := fmt.Sprintf("quake_datagrams_dropped_total{reason=%q}", reason)
+		for !strings.Contains(metrics(srv), sample) {
+			select {
+			case <-ctx.Done():
+				t.Fatalf("no %s datagrams counted", reason)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+}
+
+func metrics(srv *server.Server) string {
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	return w.Body.String()
+}
@@ -0,0 +1,180 @@
+// Package memnet is an in-memory datagram network, so that a server and its
+// clients may talk to one another in a single process without sockets.
+//
+// Like UDP, delivery is unreliable: a datagram to an address on which nobody
+// listens, or to a conn whose queue is full, is silently dropped.
+package memnet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// queueLen is how many datagrams a conn holds before it drops new ones.
+const queueLen = 256
+
+var (
+	ErrClosed    = errors.New("memnet: use of closed connection")
+	ErrAddrInUse = errors.New("memnet: address already in use")
+)
+
+type errTimeout struct{}
+
+func (errTimeout) Error() string   { return "memnet: i/o timeout" }
+func (errTimeout) Timeout() bool   { return true }
+func (errTimeout) Temporary() bool { return true }
+
+type datagram struct {
+	data []byte
+	from net.Addr
+}
+
+// Network routes datagrams among the conns that listen on it.  The zero value
+// is ready for use.
+type Network struct {
+	mtx      sync.Mutex
+	conns    map[string]*Conn
+	nextPort int
+}
+
+// Listen opens a conn at addr, a host and port.  Port 0 picks a free port.
+func (n *Network) Listen(addr string) (*Conn, error) {
+	udp, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	if n.conns == nil {
+		n.conns = make(map[string]*Conn)
+		n.nextPort = 50000
+	}
+	if udp.Port == 0 {
+		for {
+			n.nextPort++
+			udp.Port = n.nextPort
+			if _, ok := n.conns[udp.String()]; !ok {
+				break
+			}
+		}
+	}
+	if _, ok := n.conns[udp.String()]; ok {
+		return nil, ErrAddrInUse
+	}
+	c := &Conn{
+		net:    n,
+		local:  udp,
+		in:     make(chan datagram, queueLen),
+		closed: make(chan struct{}),
+	}
+	n.conns[udp.String()] = c
+	return c, nil
+}
+
+// ListenPacket is Listen in the form that the server's Config expects.
+func (n *Network) ListenPacket(addr string) func() (net.PacketConn, error) {
+	return func() (net.PacketConn, error) { return n.Listen(addr) }
+}
+
+func (n *Network) deliver(to net.Addr, d datagram) {
+	n.mtx.Lock()
+	c, ok := n.conns[to.String()]
+	n.mtx.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case c.in <- d:
+	default:
+	}
+}
+
+func (n *Network) remove(c *Conn) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	if n.conns[c.local.String()] == c {
+		delete(n.conns, c.local.String())
+	}
+}
+
+// Conn is a net.PacketConn on a Network.
+type Conn struct {
+	net       *Network
+	local     *net.UDPAddr
+	in        chan datagram
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mtx      sync.Mutex
+	deadline time.Time
+}
+
+func (c *Conn) LocalAddr() net.Addr { return c.local }
+
+func (c *Conn) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case <-c.closed:
+		return 0, nil, ErrClosed
+	default:
+	}
+	c.mtx.Lock()
+	dl := c.deadline
+	c.mtx.Unlock()
+	var timeout <-chan time.Time
+	if !dl.IsZero() {
+		d := time.Until(dl)
+		if d <= 0 {
+			return 0, nil, errTimeout{}
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case <-c.closed:
+		return 0, nil, ErrClosed
+	case d := <-c.in:
+		return copy(p, d.data), d.from, nil
+	case <-timeout:
+		return 0, nil, errTimeout{}
+	}
+}
+
+func (c *Conn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, ErrClosed
+	default:
+	}
+	if addr == nil {
+		return 0, fmt.Errorf("memnet: no destination address")
+	}
+	c.net.deliver(addr, datagram{data: append([]byte(nil), p...), from: c.local})
+	return len(p), nil
+}
+
+func (c *Conn) Close() error {
+	err := ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.net.remove(c)
+		err = nil
+	})
+	return err
+}
+
+func (c *Conn) SetDeadline(t time.Time) error { return c.SetReadDeadline(t) }
+
+// SetReadDeadline applies to reads that begin after it is called.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mtx.Lock()
+	c.deadline = t
+	c.mtx.Unlock()
+	return nil
+}
+
+// SetWriteDeadline does nothing, since writes never block.
+func (c *Conn) SetWriteDeadline(t time.Time) error { return nil }
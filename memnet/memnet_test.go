@@ -0,0 +1,55 @@
+package memnet
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNetwork(t *testing.T) {
+	var nw Network
+	a, err := nw.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := nw.Listen("127.0.0.1:26000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nw.Listen("127.0.0.1:26000"); err != ErrAddrInUse {
+		t.Errorf("second listen = %v, want = %v", err, ErrAddrInUse)
+	}
+
+	if _, err := a.WriteTo([]byte("ping"), b.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	// Nobody listens here, so the datagram vanishes.
+	if _, err := a.WriteTo([]byte("lost"), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}); err != nil {
+		t.Fatal(err)
+	}
+	var buf [16]byte
+	n, from, err := b.ReadFrom(buf[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf[:n], []byte("ping"); !bytes.Equal(got, want) {
+		t.Errorf("got = %q, want = %q", got, want)
+	}
+	if got, want := from.String(), a.LocalAddr().String(); got != want {
+		t.Errorf("from = %v, want = %v", got, want)
+	}
+
+	b.SetReadDeadline(time.Now().Add(time.Millisecond))
+	if _, _, err := b.ReadFrom(buf[:]); err == nil || !err.(net.Error).Timeout() {
+		t.Errorf("read past deadline = %v, want timeout", err)
+	}
+
+	b.Close()
+	if _, _, err := b.ReadFrom(buf[:]); err != ErrClosed {
+		t.Errorf("read after close = %v, want = %v", err, ErrClosed)
+	}
+	if _, err := nw.Listen("127.0.0.1:26000"); err != nil {
+		t.Errorf("listen after close = %v", err)
+	}
+}
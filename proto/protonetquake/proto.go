@@ -1,6 +1,8 @@
 // Package protonetquake defines the netquake protocol, the protocol used in the original game.
 package protonetquake
 
+import "encoding/binary"
+
 const (
 	SVCBad          byte = 0
 	SVCNop               = 1
@@ -61,3 +63,78 @@ const (
 	TEImplosion         = 14
 	TERailTrail         = 15
 )
+
+// ProtocolVersion is the version of the game protocol sent in svc_serverinfo.
+const ProtocolVersion = 15
+
+const (
+	GameCoop       byte = 0
+	GameDeathmatch      = 1
+)
+
+// DefaultPort is that on which this module's servers listen unless told
+// otherwise.
+const DefaultPort = 8080
+
+// StockPort is that on which the original game's servers listen.
+const StockPort = 26000
+
+// NetProtocolVersion is the version of the connection control protocol.
+const NetProtocolVersion = 3
+
+const (
+	CCReqConnect    byte = 0x01
+	CCReqServerInfo      = 0x02
+	CCReqPlayerInfo      = 0x03
+	CCReqRuleInfo        = 0x04
+	CCReqRcon            = 0x05
+
+	CCRepAccept     byte = 0x81
+	CCRepReject          = 0x82
+	CCRepServerInfo      = 0x83
+	CCRepPlayerInfo      = 0x84
+	CCRepRuleInfo        = 0x85
+	CCRepRcon            = 0x86
+)
+
+// The first word of every datagram holds its length and these flags.
+const (
+	NetflagLengthMask uint32 = 0x0000ffff
+	NetflagData       uint32 = 0x00010000
+	NetflagAck        uint32 = 0x00020000
+	NetflagNak        uint32 = 0x00040000
+	NetflagEOM        uint32 = 0x00080000
+	NetflagUnreliable uint32 = 0x00100000
+	NetflagControl    uint32 = 0x80000000
+)
+
+const (
+	// MaxDatagram is the largest datagram either side sends.
+	MaxDatagram = 1024
+	// NetHeaderSize is the length and sequence words of a data datagram.
+	NetHeaderSize = 8
+	// CtrlHeaderSize is the length word and command byte of a control packet.
+	CtrlHeaderSize = 5
+)
+
+// CtrlPacket frames payload as a control packet carrying cmd.
+func CtrlPacket(cmd byte, payload []byte) []byte {
+	out := make([]byte, CtrlHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(out, NetflagControl|uint32(len(out)))
+	out[4] = cmd
+	copy(out[CtrlHeaderSize:], payload)
+	return out
+}
+
+// ParseCtrl returns the command and payload of the control packet data.  ok
+// is false if data is not a whole control packet.
+func ParseCtrl(data []byte) (cmd byte, payload []byte, ok bool) {
+	if len(data) < CtrlHeaderSize {
+		return 0, nil, false
+	}
+	hdr := binary.BigEndian.Uint32(data)
+	if hdr&^NetflagLengthMask != NetflagControl || int(hdr&NetflagLengthMask) != len(data) {
+		return 0, nil, false
+	}
+	return data[4], data[CtrlHeaderSize:], true
+}
@@ -0,0 +1,186 @@
+// Package rcon implements the remote console control requests, by which an
+// operator who knows a server's rcon_password may run console commands.
+//
+// A request carries the time at which it was made, a random nonce and the
+// command, authenticated together with HMAC-SHA256 keyed by the password, so
+// that a captured request can neither be altered nor replayed outside of the
+// server's window of acceptance.  The server answers with the command's
+// console output, split across as many replies as needed.
+package rcon
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+)
+
+const (
+	macSz      = sha256.Size
+	requestSz  = 8 + 8 + macSz // time, nonce and MAC
+	replyHdrSz = 8 + 1 + 1     // nonce, part and parts
+
+	// MaxReplyText is the most output that a single reply carries.
+	MaxReplyText = protonetquake.MaxDatagram - protonetquake.CtrlHeaderSize - replyHdrSz - 1
+)
+
+var (
+	ErrBadMAC   = errors.New("rcon: bad password")
+	ErrTooShort = errors.New("rcon: message too short")
+	ErrNotRcon  = errors.New("rcon: not an rcon message")
+)
+
+type Request struct {
+	Time    time.Time
+	Nonce   uint64
+	Command string
+}
+
+// NewRequest prepares a request for command with a fresh nonce.
+func NewRequest(command string) (*Request, error) {
+	var n [8]byte
+	if _, err := rand.Read(n[:]); err != nil {
+		return nil, err
+	}
+	return &Request{Time: time.Now(), Nonce: binary.LittleEndian.Uint64(n[:]), Command: command}, nil
+}
+
+func mac(password string, ts int64, nonce uint64, command string) []byte {
+	h := hmac.New(sha256.New, []byte(password))
+	binary.Write(h, binary.LittleEndian, ts)
+	binary.Write(h, binary.LittleEndian, nonce)
+	h.Write([]byte(command))
+	return h.Sum(nil)
+}
+
+// Encode returns the control packet for the request authenticated with
+// password.
+func (r *Request) Encode(password string) []byte {
+	ts := r.Time.UnixNano()
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, ts)
+	binary.Write(&buf, binary.LittleEndian, r.Nonce)
+	buf.Write(mac(password, ts, r.Nonce, r.Command))
+	buf.WriteString(r.Command)
+	buf.WriteByte(0)
+	return protonetquake.CtrlPacket(protonetquake.CCReqRcon, buf.Bytes())
+}
+
+// ParseRequest decodes and authenticates the body of a CCREQ_RCON control
+// packet, which follows its command byte.  A request that fails
+// authentication is returned with only its nonce, by which the failure may be
+// reported.
+func ParseRequest(data []byte, password string) (*Request, error) {
+	if len(data) < requestSz+1 {
+		return nil, ErrTooShort
+	}
+	ts := int64(binary.LittleEndian.Uint64(data[0:8]))
+	nonce := binary.LittleEndian.Uint64(data[8:16])
+	sum := data[16:requestSz]
+	cmd := data[requestSz:]
+	if i := bytes.IndexByte(cmd, 0); i != -1 {
+		cmd = cmd[:i]
+	}
+	if !hmac.Equal(sum, mac(password, ts, nonce, string(cmd))) {
+		return &Request{Nonce: nonce}, ErrBadMAC
+	}
+	return &Request{Time: time.Unix(0, ts), Nonce: nonce, Command: string(cmd)}, nil
+}
+
+// EncodeReply splits text into the replies to the request with nonce.
+func EncodeReply(nonce uint64, text string) [][]byte {
+	var parts []string
+	for len(text) > MaxReplyText {
+		parts = append(parts, text[:MaxReplyText])
+		text = text[MaxReplyText:]
+	}
+	parts = append(parts, text)
+	out := make([][]byte, len(parts))
+	for i, p := range parts {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, nonce)
+		buf.WriteByte(byte(i))
+		buf.WriteByte(byte(len(parts)))
+		buf.WriteString(p)
+		buf.WriteByte(0)
+		out[i] = protonetquake.CtrlPacket(protonetquake.CCRepRcon, buf.Bytes())
+	}
+	return out
+}
+
+type Reply struct {
+	Nonce       uint64
+	Part, Parts int
+	Text        string
+}
+
+// ParseReply decodes a CCREP_RCON control packet.
+func ParseReply(data []byte) (*Reply, error) {
+	if len(data) < protonetquake.CtrlHeaderSize+replyHdrSz {
+		return nil, ErrTooShort
+	}
+	cmd, data, ok := protonetquake.ParseCtrl(data)
+	if !ok || cmd != protonetquake.CCRepRcon {
+		return nil, ErrNotRcon
+	}
+	text := data[replyHdrSz:]
+	if i := bytes.IndexByte(text, 0); i != -1 {
+		text = text[:i]
+	}
+	return &Reply{
+		Nonce: binary.LittleEndian.Uint64(data[0:8]),
+		Part:  int(data[8]),
+		Parts: int(data[9]),
+		Text:  string(text),
+	}, nil
+}
+
+// Exec runs command on the server at addr and returns its console output.
+func Exec(conn net.PacketConn, addr net.Addr, password, command string, timeout time.Duration) (string, error) {
+	req, err := NewRequest(command)
+	if err != nil {
+		return "", err
+	}
+	if _, err := conn.WriteTo(req.Encode(password), addr); err != nil {
+		return "", err
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return "", err
+	}
+	var (
+		parts []string
+		have  []bool
+		got   int
+		buf   [protonetquake.MaxDatagram]byte
+	)
+	for parts == nil || got < len(parts) {
+		n, _, err := conn.ReadFrom(buf[:])
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				return strings.Join(parts, ""), fmt.Errorf("rcon: received %d of %d replies", got, len(parts))
+			}
+			return "", err
+		}
+		r, err := ParseReply(buf[:n])
+		if err != nil || r.Nonce != req.Nonce || r.Parts == 0 || r.Part >= r.Parts {
+			continue
+		}
+		if parts == nil {
+			parts, have = make([]string, r.Parts), make([]bool, r.Parts)
+		}
+		if r.Parts != len(parts) || have[r.Part] {
+			continue
+		}
+		parts[r.Part], have[r.Part] = r.Text, true
+		got++
+	}
+	return strings.Join(parts, ""), nil
+}
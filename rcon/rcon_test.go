@@ -0,0 +1,110 @@
+package rcon
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+)
+
+func TestRequestRoundTrip(t *testing.T) {
+	req := &Request{Time: time.Unix(1234, 5678), Nonce: 42, Command: "kick # 1"}
+	pkt := req.Encode("secret")
+	for _, test := range []struct {
+		password string
+		req      *Request
+		err      error
+	}{
+		{password: "secret", req: req},
+		{password: "guess", err: ErrBadMAC},
+	} {
+		got, err := ParseRequest(pkt[protonetquake.CtrlHeaderSize:], test.password)
+		if err != test.err {
+			t.Errorf("got = %v, want = %v", err, test.err)
+		}
+		if got.Nonce != req.Nonce {
+			t.Errorf("got = %v, want = %v", got.Nonce, req.Nonce)
+		}
+		if test.req == nil {
+			continue
+		}
+		if !got.Time.Equal(test.req.Time) || got.Nonce != test.req.Nonce || got.Command != test.req.Command {
+			t.Errorf("got = %v, want = %v", got, test.req)
+		}
+	}
+	tampered := append([]byte(nil), pkt...)
+	tampered[len(tampered)-2] = '2'
+	if _, err := ParseRequest(tampered[protonetquake.CtrlHeaderSize:], "secret"); err != ErrBadMAC {
+		t.Errorf("got = %v, want = %v", err, ErrBadMAC)
+	}
+	if _, err := ParseRequest(pkt[protonetquake.CtrlHeaderSize:20], "secret"); err != ErrTooShort {
+		t.Errorf("got = %v, want = %v", err, ErrTooShort)
+	}
+}
+
+func TestReplyRoundTrip(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"hostname is \"test\"\n",
+		strings.Repeat("x", 2*MaxReplyText+1),
+	} {
+		pkts := EncodeReply(7, text)
+		var out string
+		for i, p := range pkts {
+			if len(p) > protonetquake.MaxDatagram {
+				t.Errorf("reply of %d bytes exceeds datagram", len(p))
+			}
+			r, err := ParseReply(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := &Reply{Nonce: 7, Part: i, Parts: len(pkts), Text: r.Text}
+			if !reflect.DeepEqual(r, want) {
+				t.Errorf("got = %v, want = %v", r, want)
+			}
+			out += r.Text
+		}
+		if out != text {
+			t.Errorf("got %d bytes, want %d", len(out), len(text))
+		}
+	}
+}
+
+func TestExec(t *testing.T) {
+	srv, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	output := strings.Repeat("status line\n", 200)
+	go func() {
+		var buf [protonetquake.MaxDatagram]byte
+		n, from, err := srv.ReadFrom(buf[:])
+		if err != nil {
+			return
+		}
+		req, err := ParseRequest(buf[protonetquake.CtrlHeaderSize:n], "secret")
+		if err != nil || req.Command != "status" {
+			return
+		}
+		pkts := EncodeReply(req.Nonce, output)
+		for i := len(pkts) - 1; i >= 0; i-- {
+			srv.WriteTo(pkts[i], from)
+		}
+	}()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	got, err := Exec(conn, srv.LocalAddr(), "secret", "status", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != output {
+		t.Errorf("got = %q, want = %q", got, output)
+	}
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/matttproud/go-quake/cvar"
+)
+
+// The JSON administration API is served alongside the other inspection
+// handlers.  Every request runs on the host frame, so handlers observe a
+// consistent server.
+
+const apiTimeout = 5 * time.Second
+
+type apiPlayer struct {
+	Id          string    `json:"id"`
+	Name        string    `json:"name"`
+	Address     string    `json:"address"`
+	Colors      int       `json:"colors"`
+	Frags       int       `json:"frags"`
+	Ping        float32   `json:"ping"`
+	ConnectTime time.Time `json:"connect_time"`
+}
+
+type apiStatus struct {
+	Hostname   string      `json:"hostname"`
+	Map        string      `json:"map"`
+	Time       float64     `json:"time"`
+	State      string      `json:"state"`
+	MaxPlayers int         `json:"max_players"`
+	Players    []apiPlayer `json:"players"`
+}
+
+type apiCvar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type apiCommand struct {
+	Command string `json:"command"`
+}
+
+type apiCommandResult struct {
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, apiError{Error: err.Error()})
+}
+
+// onFrame runs fn on the host frame, giving up after apiTimeout.
+func (s *Server) onFrame(fn func()) error {
+	ctx, cancel := context.WithTimeout(context.Background(), apiTimeout)
+	defer cancel()
+	return s.Do(ctx, fn)
+}
+
+func (s *Server) apiStatus() apiStatus {
+	st := apiStatus{
+		Hostname:   s.cvHostname.Get(),
+		Map:        s.Map,
+		Time:       s.Time.Seconds(),
+		State:      s.State.String(),
+		MaxPlayers: s.MaxPlayers,
+		Players:    []apiPlayer{},
+	}
+	for _, sess := range s.Sessions {
+		st.Players = append(st.Players, apiPlayer{
+			Id:          sess.Id,
+			Name:        sess.Player.Name,
+			Address:     sess.RemoteAddr.String(),
+			Colors:      sess.Player.Colors,
+			Frags:       sess.Player.Frags,
+			Ping:        sess.Player.Ping(),
+			ConnectTime: sess.Player.ConnectTime,
+		})
+	}
+	return st
+}
+
+func (s *Server) handleAPIStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var st apiStatus
+	if err := s.onFrame(func() { st = s.apiStatus() }); err != nil {
+		writeAPIError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// handleAPICvars serves GET and PUT /api/cvars/<name>.  Secret variables may
+// be set but are never shown.
+func (s *Server) handleAPICvars(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/cvars/")
+	if name == "" || name == r.URL.Path {
+		s.handleAPICvarList(w, r)
+		return
+	}
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var cv apiCvar
+		if err := json.NewDecoder(r.Body).Decode(&cv); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		var perr error
+		err := s.onFrame(func() {
+			v, ok := s.Cvars.Lookup(name)
+			if !ok {
+				perr = errUnknownCvar(name)
+				return
+			}
+			perr = v.Parse(cv.Value)
+		})
+		switch {
+		case err != nil:
+			writeAPIError(w, http.StatusServiceUnavailable, err)
+			return
+		case perr != nil:
+			writeAPIError(w, apiErrorCode(perr), perr)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var (
+		cv         apiCvar
+		ok, secret bool
+	)
+	err := s.onFrame(func() {
+		var v cvar.Var
+		if v, ok = s.Cvars.Lookup(name); ok {
+			cv = apiCvar{Name: name, Value: v.String()}
+			secret = v.Secret()
+		}
+	})
+	switch {
+	case err != nil:
+		writeAPIError(w, http.StatusServiceUnavailable, err)
+	case !ok:
+		writeAPIError(w, http.StatusNotFound, errUnknownCvar(name))
+	case secret && r.Method == "PUT":
+		w.WriteHeader(http.StatusNoContent)
+	case secret:
+		writeAPIError(w, http.StatusForbidden, errSecretCvar(name))
+	default:
+		writeJSON(w, http.StatusOK, cv)
+	}
+}
+
+func (s *Server) handleAPICvarList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	out := []apiCvar{}
+	err := s.onFrame(func() {
+		for _, n := range s.Cvars.Names() {
+			if v, ok := s.Cvars.Lookup(n); ok && !v.Secret() {
+				out = append(out, apiCvar{Name: n, Value: v.String()})
+			}
+		}
+	})
+	if err != nil {
+		writeAPIError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+type errUnknownCvar string
+
+func (e errUnknownCvar) Error() string { return "unknown cvar: " + string(e) }
+
+type errSecretCvar string
+
+func (e errSecretCvar) Error() string { return "secret cvar: " + string(e) }
+
+func apiErrorCode(err error) int {
+	switch err.(type) {
+	case errUnknownCvar, errUnknownSession, errUnknownPlayer:
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+func (s *Server) handleAPICommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var cmd apiCommand
+	if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	var (
+		out  bytes.Buffer
+		eerr error
+	)
+	err := s.onFrame(func() {
+		restore := s.con.redirect(&out)
+		defer restore()
+		eerr = s.Exec(cmd.Command)
+	})
+	if err != nil {
+		writeAPIError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	res := apiCommandResult{Output: out.String()}
+	if eerr != nil {
+		res.Error = eerr.Error()
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleAPISessions serves POST /api/sessions/<id>/kick.
+func (s *Server) handleAPISessions(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/sessions/")
+	if !strings.HasSuffix(rest, "/kick") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimSuffix(rest, "/kick")
+	var kerr error
+	err := s.onFrame(func() {
+		sess, ok := s.Sessions[id]
+		if !ok {
+			kerr = errUnknownSession(id)
+			return
+		}
+		s.Kick(sess, "Console", "")
+	})
+	switch {
+	case err != nil:
+		writeAPIError(w, http.StatusServiceUnavailable, err)
+	case kerr != nil:
+		writeAPIError(w, apiErrorCode(kerr), kerr)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Handler serves the administration API and the metrics.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/status", s.handleAPIStatus)
+	mux.HandleFunc("/api/cvars", s.handleAPICvars)
+	mux.HandleFunc("/api/cvars/", s.handleAPICvars)
+	mux.HandleFunc("/api/command", s.handleAPICommand)
+	mux.HandleFunc("/api/sessions/", s.handleAPISessions)
+	mux.HandleFunc("/api/stats", s.handleAPIStats)
+	mux.HandleFunc("/api/stats/", s.handleAPIStats)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	return mux
+}
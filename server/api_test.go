@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runFrames executes the host frames of s until the returned function is
+// called.
+func runFrames(s *Server) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				s.Frame(time.Now())
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func TestAPICvars(t *testing.T) {
+	srv := newTestServer(t)
+	defer runFrames(srv)()
+	srv.Cvars.NewString("api_test", "before")
+
+	for _, test := range []struct {
+		method, path, body string
+		code               int
+		value              string
+	}{
+		{method: "GET", path: "/api/cvars/api_test", code: http.StatusOK, value: "before"},
+		{method: "PUT", path: "/api/cvars/api_test", body: `{"value":"after"}`, code: http.StatusOK, value: "after"},
+		{method: "GET", path: "/api/cvars/api_test", code: http.StatusOK, value: "after"},
+		{method: "GET", path: "/api/cvars/no_such_cvar", code: http.StatusNotFound},
+		{method: "PUT", path: "/api/cvars/no_such_cvar", body: `{"value":"1"}`, code: http.StatusNotFound},
+		{method: "DELETE", path: "/api/cvars/api_test", code: http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		srv.handleAPICvars(w, r)
+		if got, want := w.Code, test.code; got != want {
+			t.Errorf("%s %s: got = %v, want = %v", test.method, test.path, got, want)
+		}
+		if test.code != http.StatusOK {
+			continue
+		}
+		var cv apiCvar
+		if err := json.NewDecoder(w.Body).Decode(&cv); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := cv.Value, test.value; got != want {
+			t.Errorf("%s %s: got = %v, want = %v", test.method, test.path, got, want)
+		}
+	}
+}
+
+func TestAPICommand(t *testing.T) {
+	srv := newTestServer(t)
+	defer runFrames(srv)()
+
+	for _, test := range []struct {
+		body string
+		res  apiCommandResult
+	}{
+		{
+			body: `{"command":"hostname \"api test\"; hostname"}`,
+			res:  apiCommandResult{Output: "\"hostname\" is \"api test\"\n"},
+		},
+		{
+			body: `{"command":"no_such_command"}`,
+			res:  apiCommandResult{Error: `Unknown command "no_such_command"`},
+		},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/command", strings.NewReader(test.body))
+		srv.handleAPICommand(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+		var res apiCommandResult
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := res, test.res; got != want {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+	}
+}
+
+func TestAPICvarsHidesSecrets(t *testing.T) {
+	srv := newTestServer(t)
+	defer runFrames(srv)()
+	srv.cvPassword.Set("hunter2")
+	srv.cvRconPassword.Set("swordfish")
+
+	w := httptest.NewRecorder()
+	srv.handleAPICvars(w, httptest.NewRequest("GET", "/api/cvars", nil))
+	var list []apiCvar
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) == 0 {
+		t.Fatal("listing is empty")
+	}
+	for _, cv := range list {
+		if cv.Name == "sv_password" || cv.Name == "rcon_password" {
+			t.Errorf("listing holds %s = %q", cv.Name, cv.Value)
+		}
+	}
+
+	for _, test := range []struct {
+		method, body string
+		code         int
+	}{
+		{"GET", "", http.StatusForbidden},
+		{"PUT", `{"value":"letmein"}`, http.StatusNoContent},
+	} {
+		w := httptest.NewRecorder()
+		srv.handleAPICvars(w, httptest.NewRequest(test.method, "/api/cvars/sv_password", strings.NewReader(test.body)))
+		if got, want := w.Code, test.code; got != want {
+			t.Errorf("%s: got = %v, want = %v", test.method, got, want)
+		}
+		if body := w.Body.String(); strings.Contains(body, "hunter2") || strings.Contains(body, "letmein") {
+			t.Errorf("%s: body = %q reveals the password", test.method, body)
+		}
+	}
+	if got, want := srv.cvPassword.Get(), "letmein"; got != want {
+		t.Errorf("sv_password = %q, want = %q", got, want)
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/matttproud/go-quake/path"
+)
+
+// GamePath finds the game assets in baseDir: those of id1 and, if game is
+// set, those of the alternative game that takes precedence over them.
+func GamePath(baseDir, game string) (*path.Path, error) {
+	var paths []string
+	if game != "" {
+		paths = append(paths, filepath.Join(baseDir, game))
+	}
+	id1Path := filepath.Join(baseDir, "id1")
+	if _, err := os.Stat(id1Path); err != nil {
+		return nil, fmt.Errorf("could not access id1 directory: %v", err)
+	}
+	paths = append(paths, id1Path)
+	for _, p := range paths {
+		paks, err := filepath.Glob(filepath.Join(p, "*.pak"))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, paks...)
+	}
+	return path.New(paths...)
+}
+
+// GameDir is the directory to which a server of game in baseDir writes its
+// files.
+func GameDir(baseDir, game string) string {
+	if game != "" {
+		return filepath.Join(baseDir, game)
+	}
+	return filepath.Join(baseDir, "id1")
+}
@@ -0,0 +1,338 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/matttproud/go-quake/cvar"
+)
+
+const banFile = "bans.txt"
+
+type banVars struct {
+	cvAllowList *cvar.Float
+}
+
+type Ban struct {
+	Net    *net.IPNet
+	Expiry time.Time // zero if permanent
+	Reason string
+}
+
+func (b *Ban) Expired(now time.Time) bool {
+	return !b.Expiry.IsZero() && !now.Before(b.Expiry)
+}
+
+// BanList holds the networks barred from connecting and, for private matches
+// with sv_allowlist set, the only networks that may.
+type BanList struct {
+	Bans  []*Ban
+	Allow []*net.IPNet
+	path  string
+}
+
+// parseNet parses an address in CIDR notation, treating a bare address as a
+// network of one host.
+func parseNet(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address %q", s)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	return n, err
+}
+
+func addrIP(addr net.Addr) net.IP {
+	if u, ok := addr.(*net.UDPAddr); ok {
+		return u.IP
+	}
+	return net.ParseIP(hostKey(addr))
+}
+
+// Check reports the reason for which ip may not connect, if any.  A private
+// server admits only those on the allow list.
+func (l *BanList) Check(ip net.IP, now time.Time, private bool) (reason string, barred bool) {
+	for _, b := range l.Bans {
+		if b.Expired(now) || !b.Net.Contains(ip) {
+			continue
+		}
+		if b.Reason == "" {
+			return "You have been banned.\n", true
+		}
+		return "You have been banned: " + b.Reason + "\n", true
+	}
+	if !private {
+		return "", false
+	}
+	for _, n := range l.Allow {
+		if n.Contains(ip) {
+			return "", false
+		}
+	}
+	return "This server is private.\n", true
+}
+
+func (l *BanList) Ban(n *net.IPNet, expiry time.Time, reason string) {
+	l.Unban(n)
+	l.Bans = append(l.Bans, &Ban{Net: n, Expiry: expiry, Reason: reason})
+}
+
+func (l *BanList) Unban(n *net.IPNet) bool {
+	for i, b := range l.Bans {
+		if b.Net.String() == n.String() {
+			l.Bans = append(l.Bans[:i], l.Bans[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (l *BanList) AddAllow(n *net.IPNet) {
+	l.RemoveAllow(n)
+	l.Allow = append(l.Allow, n)
+}
+
+func (l *BanList) RemoveAllow(n *net.IPNet) bool {
+	for i, a := range l.Allow {
+		if a.String() == n.String() {
+			l.Allow = append(l.Allow[:i], l.Allow[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Prune forgets the bans that have expired.
+func (l *BanList) Prune(now time.Time) {
+	bans := l.Bans[:0]
+	for _, b := range l.Bans {
+		if !b.Expired(now) {
+			bans = append(bans, b)
+		}
+	}
+	l.Bans = bans
+}
+
+// The ban file holds one entry per line:
+//
+//	ban <cidr> <expiry as RFC 3339 or -> [reason]
+//	allow <cidr>
+func (l *BanList) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for _, b := range l.Bans {
+		exp := "-"
+		if !b.Expiry.IsZero() {
+			exp = b.Expiry.UTC().Format(time.RFC3339)
+		}
+		line := fmt.Sprintf("ban %s %s", b.Net, exp)
+		if b.Reason != "" {
+			line += " " + b.Reason
+		}
+		c, err := fmt.Fprintln(w, line)
+		n += int64(c)
+		if err != nil {
+			return n, err
+		}
+	}
+	for _, a := range l.Allow {
+		c, err := fmt.Fprintf(w, "allow %s\n", a)
+		n += int64(c)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (l *BanList) ReadFrom(r io.Reader) (int64, error) {
+	var n int64
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		n += int64(len(scanner.Bytes()) + 1)
+		f := strings.SplitN(strings.TrimSpace(scanner.Text()), " ", 4)
+		switch {
+		case f[0] == "" || strings.HasPrefix(f[0], "//"):
+		case f[0] == "ban" && len(f) >= 3:
+			ipn, err := parseNet(f[1])
+			if err != nil {
+				return n, fmt.Errorf("line %d: %v", line, err)
+			}
+			b := &Ban{Net: ipn}
+			if f[2] != "-" {
+				if b.Expiry, err = time.Parse(time.RFC3339, f[2]); err != nil {
+					return n, fmt.Errorf("line %d: %v", line, err)
+				}
+			}
+			if len(f) == 4 {
+				b.Reason = f[3]
+			}
+			l.Bans = append(l.Bans, b)
+		case f[0] == "allow" && len(f) == 2:
+			ipn, err := parseNet(f[1])
+			if err != nil {
+				return n, fmt.Errorf("line %d: %v", line, err)
+			}
+			l.Allow = append(l.Allow, ipn)
+		default:
+			return n, fmt.Errorf("line %d: malformed entry", line)
+		}
+	}
+	return n, scanner.Err()
+}
+
+// LoadBanList reads the ban list from path, which needn't exist yet.
+func LoadBanList(path string) (*BanList, error) {
+	l := &BanList{path: path}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := l.ReadFrom(f); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return l, nil
+}
+
+// Save writes the list back to the file from which it was loaded.
+func (l *BanList) Save() error {
+	if l.path == "" {
+		return nil
+	}
+	tmp := l.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := l.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+func (s *Server) cmdBan(args ...string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: ban <ip/cidr> [duration] [reason]")
+	}
+	n, err := parseNet(args[0])
+	if err != nil {
+		return err
+	}
+	var expiry time.Time
+	args = args[1:]
+	if len(args) > 0 {
+		if d, err := time.ParseDuration(args[0]); err == nil {
+			expiry = s.clock.Now().Add(d)
+			args = args[1:]
+		}
+	}
+	s.Bans.Ban(n, expiry, strings.Join(args, " "))
+	if expiry.IsZero() {
+		s.conPrintf("Banned %s\n", n)
+	} else {
+		s.conPrintf("Banned %s until %s\n", n, expiry.Format(time.RFC1123))
+	}
+	now := s.clock.Now()
+	for _, sess := range s.Sessions.Sorted() {
+		ip := addrIP(sess.RemoteAddr)
+		if ip == nil || !n.Contains(ip) {
+			continue
+		}
+		if reason, barred := s.Bans.Check(ip, now, false); barred {
+			s.conPrintf("%s was banned\n", sess.Player.Name)
+			sess.Drop(reason)
+		}
+	}
+	return s.Bans.Save()
+}
+
+func (s *Server) cmdUnban(args ...string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: unban <ip/cidr>")
+	}
+	n, err := parseNet(args[0])
+	if err != nil {
+		return err
+	}
+	if !s.Bans.Unban(n) {
+		return fmt.Errorf("%s is not banned", n)
+	}
+	s.conPrintf("Unbanned %s\n", n)
+	return s.Bans.Save()
+}
+
+func (s *Server) cmdBanList(args ...string) error {
+	now := s.clock.Now()
+	s.Bans.Prune(now)
+	for _, b := range s.Bans.Bans {
+		exp := "permanent"
+		if !b.Expiry.IsZero() {
+			exp = b.Expiry.Sub(now).Truncate(time.Second).String() + " left"
+		}
+		s.conPrintf("%-18s %-14s %s\n", b.Net, exp, b.Reason)
+	}
+	if s.cvAllowList.Get() != 0 {
+		s.conPrintf("Allow list in effect:\n")
+	}
+	for _, a := range s.Bans.Allow {
+		s.conPrintf("%-18s allowed\n", a)
+	}
+	return nil
+}
+
+func (s *Server) cmdAllow(args ...string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: allow <ip/cidr>")
+	}
+	n, err := parseNet(args[0])
+	if err != nil {
+		return err
+	}
+	s.Bans.AddAllow(n)
+	s.conPrintf("Allowed %s\n", n)
+	return s.Bans.Save()
+}
+
+func (s *Server) cmdDisallow(args ...string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: disallow <ip/cidr>")
+	}
+	n, err := parseNet(args[0])
+	if err != nil {
+		return err
+	}
+	if !s.Bans.RemoveAllow(n) {
+		return fmt.Errorf("%s is not on the allow list", n)
+	}
+	s.conPrintf("Disallowed %s\n", n)
+	return s.Bans.Save()
+}
+
+func (s *Server) initBanList() {
+	s.addCommand("ban", s.cmdBan)
+	s.addCommand("unban", s.cmdUnban)
+	s.addCommand("banlist", s.cmdBanList)
+	s.addCommand("allow", s.cmdAllow)
+	s.addCommand("disallow", s.cmdDisallow)
+
+	s.cvAllowList = s.newFloat("sv_allowlist", 0)
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+)
+
+func mustParseNet(t *testing.T, s string) *net.IPNet {
+	n, err := parseNet(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestBanListCheck(t *testing.T) {
+	now := time.Unix(1000, 0)
+	var l BanList
+	l.Ban(mustParseNet(t, "10.0.0.0/8"), time.Time{}, "")
+	l.Ban(mustParseNet(t, "192.168.1.7"), now.Add(time.Minute), "camping")
+	l.Ban(mustParseNet(t, "172.16.0.1"), now.Add(-time.Minute), "")
+	l.AddAllow(mustParseNet(t, "192.168.0.0/16"))
+	for _, test := range []struct {
+		ip        string
+		allowList bool
+		reason    string
+	}{
+		{ip: "10.1.2.3", reason: "You have been banned.\n"},
+		{ip: "192.168.1.7", reason: "You have been banned: camping\n"},
+		{ip: "192.168.1.8"},
+		{ip: "172.16.0.1"},
+		{ip: "8.8.8.8"},
+		{ip: "8.8.8.8", allowList: true, reason: "This server is private.\n"},
+		{ip: "192.168.1.8", allowList: true},
+		{ip: "192.168.1.7", allowList: true, reason: "You have been banned: camping\n"},
+	} {
+		reason, barred := l.Check(net.ParseIP(test.ip), now, test.allowList)
+		if got, want := reason, test.reason; got != want {
+			t.Errorf("%s: got = %q, want = %q", test.ip, got, want)
+		}
+		if got, want := barred, test.reason != ""; got != want {
+			t.Errorf("%s: got = %v, want = %v", test.ip, got, want)
+		}
+	}
+}
+
+func TestBanListRoundTrip(t *testing.T) {
+	var l BanList
+	l.Ban(mustParseNet(t, "10.0.0.0/8"), time.Time{}, "")
+	l.Ban(mustParseNet(t, "192.168.1.7"), time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), "spamming the chat")
+	l.AddAllow(mustParseNet(t, "2001:db8::/32"))
+	var buf bytes.Buffer
+	if _, err := l.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	const want = `ban 10.0.0.0/8 -
+ban 192.168.1.7/32 2020-01-02T03:04:05Z spamming the chat
+allow 2001:db8::/32
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got = %q, want = %q", got, want)
+	}
+	var read BanList
+	if _, err := read.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var again bytes.Buffer
+	read.WriteTo(&again)
+	if got := again.String(); got != want {
+		t.Errorf("got = %q, want = %q", got, want)
+	}
+	if _, err := read.ReadFrom(bytes.NewBufferString("deny 1.2.3.4\n")); err == nil {
+		t.Error("malformed entry was accepted")
+	}
+}
+
+func TestBanDropsConnected(t *testing.T) {
+	srv := newTestServer(t)
+	conn := &recordingConn{}
+	sess, removed := newTestSession(srv, conn)
+	sess.Player.Name = "Ranger"
+	srv.Sessions[sess.Id] = sess
+
+	if err := srv.cmdBan("192.168.0.0/16"); err != nil {
+		t.Fatal(err)
+	}
+	if *removed {
+		t.Fatal("session outside the banned network was removed")
+	}
+	if err := srv.cmdBan("10.0.0.0/8", "1h", "camping"); err != nil {
+		t.Fatal(err)
+	}
+	if !*removed {
+		t.Fatal("banned session was not removed")
+	}
+	got := string(conn.writes[0][protonetquake.NetHeaderSize:])
+	if want := "\x08You have been banned: camping\n\x00\x02"; got != want {
+		t.Errorf("drop message = %q, want = %q", got, want)
+	}
+}
@@ -0,0 +1,8 @@
+package server
+
+func (s *Server) initChase() {
+	s.newFloat("chase_back", 100)
+	s.newFloat("chase_up", 16)
+	s.newFloat("chase_right", 0)
+	s.newFloat("chase_active", 0)
+}
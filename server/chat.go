@@ -0,0 +1,203 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/matttproud/go-quake/command"
+	"github.com/matttproud/go-quake/cvar"
+)
+
+// Chat follows Host_Say_f and Host_Tell_f: text is prefixed with the
+// speaker's name and, for messages to everyone, the byte that makes clients
+// play the chat sound.  The flood protection is that of QuakeWorld.
+
+const (
+	chatFile    = "chat.log"
+	chatSound   = "\x01"
+	maxChatText = 64
+)
+
+type chatVars struct {
+	cvTeamplay       *cvar.Float
+	cvFloodMessages  *cvar.Float
+	cvFloodPerSecond *cvar.Float
+	cvFloodSilence   *cvar.Float
+}
+
+// floodProt tracks when a client last spoke so that those who send more than
+// fp_messages within fp_persecond seconds are silenced for fp_secondsdead.
+type floodProt struct {
+	times  []time.Time
+	next   int
+	locked time.Time // until
+}
+
+// Allow reports whether a message may be sent at now and, if not, how long
+// the speaker remains silenced.
+func (f *floodProt) Allow(now time.Time, v *chatVars) (time.Duration, bool) {
+	if now.Before(f.locked) {
+		return f.locked.Sub(now), false
+	}
+	n := int(v.cvFloodMessages.Get())
+	if n <= 0 {
+		return 0, true
+	}
+	if len(f.times) != n {
+		f.times, f.next = make([]time.Time, n), 0
+	}
+	window := seconds(v.cvFloodPerSecond.Get())
+	if oldest := f.times[f.next]; !oldest.IsZero() && now.Sub(oldest) < window {
+		f.locked = now.Add(seconds(v.cvFloodSilence.Get()))
+		return f.locked.Sub(now), false
+	}
+	f.times[f.next] = now
+	f.next = (f.next + 1) % n
+	return 0, true
+}
+
+// chatText returns the message in the raw arguments of a chat command,
+// without the quotes around it, as Host_Say takes it.
+func chatText(text string) string {
+	if strings.HasPrefix(text, `"`) {
+		text = strings.TrimSuffix(text[1:], `"`)
+	}
+	if len(text) > maxChatText {
+		text = text[:maxChatText]
+	}
+	return text
+}
+
+// stripControl removes the control characters from chat text so that it
+// can neither break lines in the chat log nor play tricks on clients.
+// It works byte by byte, so the high-bit (coloured) characters of the
+// Quake character set pass through unchanged.
+func stripControl(text string) string {
+	b := make([]byte, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		if c := text[i]; c >= ' ' && c != 127 {
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
+
+// speaker names the sender of chat, which is the server itself when from is
+// nil.
+func (s *Server) speaker(from *Session) string {
+	if from == nil {
+		return "<" + s.cvHostname.Get() + ">"
+	}
+	return from.Player.Name
+}
+
+// logChat records chat for moderation.
+func (s *Server) logChat(kind string, from *Session, to, text string) {
+	if s.ChatLog == nil {
+		return
+	}
+	addr := "console"
+	if from != nil {
+		addr = from.RemoteAddr.String()
+	}
+	line := fmt.Sprintf("%s %s %s (%s)", s.clock.Now().Format(time.RFC3339), kind, s.speaker(from), addr)
+	if to != "" {
+		line += " -> " + to
+	}
+	fmt.Fprintf(s.ChatLog, "%s: %s\n", line, text)
+}
+
+// floodCheck reports whether from may speak, telling it otherwise.
+func (s *Server) floodCheck(from *Session) bool {
+	if from == nil {
+		return true
+	}
+	wait, ok := from.Player.flood.Allow(s.clock.Now(), &s.chatVars)
+	if !ok {
+		from.Printf("You can't talk for %d more seconds\n", int(wait.Seconds()+.5))
+	}
+	return ok
+}
+
+// Say sends text to every spawned client or, if teamOnly is set while
+// teamplay is in effect, to those on the speaker's team.
+func (s *Server) Say(from *Session, teamOnly bool, text string) {
+	text = stripControl(text)
+	if text == "" || !s.floodCheck(from) {
+		return
+	}
+	teamOnly = teamOnly && from != nil && s.cvTeamplay.Get() != 0
+	msg := chatSound + s.speaker(from) + ": " + text + "\n"
+	kind := "say"
+	if teamOnly {
+		msg = chatSound + "(" + s.speaker(from) + "): " + text + "\n"
+		kind = "say_team"
+	}
+	for _, sess := range s.Sessions {
+		if !sess.Spawned || teamOnly && sess.Player.Team != from.Player.Team {
+			continue
+		}
+		sess.print(msg)
+	}
+	s.log.Print(msg[len(chatSound):])
+	s.logChat(kind, from, "", text)
+	s.logEvent(kind, from, nil, text)
+}
+
+// Tell sends text privately to the players named to.
+func (s *Server) Tell(from *Session, to, text string) error {
+	text = stripControl(text)
+	if text == "" || !s.floodCheck(from) {
+		return nil
+	}
+	msg := s.speaker(from) + ": " + text + "\n"
+	var found bool
+	for _, sess := range s.Sessions {
+		if !sess.Spawned || !strings.EqualFold(sess.Player.Name, to) {
+			continue
+		}
+		sess.print(msg)
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("no player named %q", to)
+	}
+	s.logChat("tell", from, to, text)
+	s.logEvent("tell", from, nil, to+": "+text)
+	return nil
+}
+
+func (s *Server) cmdSay(args ...string) error {
+	s.Say(s.hostClient, false, chatText(s.argString(args)))
+	return nil
+}
+
+func (s *Server) cmdSayTeam(args ...string) error {
+	s.Say(s.hostClient, true, chatText(s.argString(args)))
+	return nil
+}
+
+func (s *Server) cmdTell(args ...string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: tell <name> <message>")
+	}
+	return s.Tell(s.hostClient, args[0], chatText(skipArg(s.argString(args))))
+}
+
+// OpenLog opens a log for appending.
+func OpenLog(path string) (io.WriteCloser, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
+
+func (s *Server) initChat() {
+	s.addCommand("say", s.cmdSay, command.ClientCallable)
+	s.addCommand("say_team", s.cmdSayTeam, command.ClientCallable)
+	s.addCommand("tell", s.cmdTell, command.ClientCallable)
+
+	s.cvFloodMessages = s.newFloat("fp_messages", 4)
+	s.cvFloodPerSecond = s.newFloat("fp_persecond", 4)
+	s.cvFloodSilence = s.newFloat("fp_secondsdead", 10)
+}
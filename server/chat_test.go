@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+)
+
+func TestFloodProt(t *testing.T) {
+	srv := newTestServer(t)
+	var f floodProt
+	start := time.Unix(0, 0)
+	for i := 0; i < 4; i++ {
+		if _, ok := f.Allow(start.Add(time.Duration(i)*time.Second/2), &srv.chatVars); !ok {
+			t.Fatalf("message %d was refused", i)
+		}
+	}
+	wait, ok := f.Allow(start.Add(2*time.Second), &srv.chatVars)
+	if ok {
+		t.Fatal("flood was allowed")
+	}
+	if got, want := wait, 10*time.Second; got != want {
+		t.Errorf("wait = %v, want = %v", got, want)
+	}
+	if _, ok := f.Allow(start.Add(11*time.Second), &srv.chatVars); ok {
+		t.Error("silenced speaker was allowed")
+	}
+	if _, ok := f.Allow(start.Add(13*time.Second), &srv.chatVars); !ok {
+		t.Error("message after silence was refused")
+	}
+}
+
+func TestSay(t *testing.T) {
+	var log bytes.Buffer
+	srv := newTestServer(t)
+	srv.ChatLog = &log
+	srv.cvTeamplay.Set(1)
+	players := []struct {
+		name    string
+		team    int
+		spawned bool
+	}{
+		{"red1", 5, true},
+		{"red2", 5, true},
+		{"blue", 14, true},
+		{"joining", 5, false},
+	}
+	var sessions []*Session
+	for i, p := range players {
+		sess, _ := newTestSession(srv, &recordingConn{})
+		sess.Id = p.name
+		sess.RemoteAddr = &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i+1)), Port: 26000}
+		sess.Player = Player{Name: p.name, Team: p.team}
+		sess.Spawned = p.spawned
+		sess.PassedAuth = true
+		srv.Sessions[sess.Id] = sess
+		sessions = append(sessions, sess)
+	}
+	printed := func(s *Session) string {
+		defer s.Message.Reset()
+		b := s.Message.Bytes()
+		if len(b) == 0 {
+			return ""
+		}
+		if b[0] != protonetquake.SVCPrint {
+			t.Fatalf("message = %v, want svc_print", b)
+		}
+		return string(bytes.TrimSuffix(b[1:], []byte{0}))
+	}
+
+	srv.ExecClient(sessions[0], []string{"say_team", "push", "left"})
+	for i, want := range []string{"\x01(red1): push left\n", "\x01(red1): push left\n", "", ""} {
+		if got := printed(sessions[i]); got != want {
+			t.Errorf("say_team to %s = %q, want = %q", players[i].name, got, want)
+		}
+	}
+
+	srv.ExecClient(sessions[2], []string{"say", "gg"})
+	for i, want := range []string{"\x01blue: gg\n", "\x01blue: gg\n", "\x01blue: gg\n", ""} {
+		if got := printed(sessions[i]); got != want {
+			t.Errorf("say to %s = %q, want = %q", players[i].name, got, want)
+		}
+	}
+
+	srv.ExecClient(sessions[1], []string{"tell", "BLUE", "nice", "shot"})
+	for i, want := range []string{"", "", "red2: nice shot\n", ""} {
+		if got := printed(sessions[i]); got != want {
+			t.Errorf("tell to %s = %q, want = %q", players[i].name, got, want)
+		}
+	}
+
+	srv.ExecClient(sessions[2], []string{"say", "hi\n2026-10-19T00:00:00Z say red1 (10.0.0.1:26000): I cheat"})
+	if got, want := printed(sessions[0]), "\x01blue: hi2026-10-19T00:00:00Z say red1 (10.0.0.1:26000): I cheat\n"; got != want {
+		t.Errorf("forged say = %q, want = %q", got, want)
+	}
+
+	sessions[2].StringCmd([]byte(`say "see http://x"`))
+	if got, want := printed(sessions[0]), "\x01blue: see http://x\n"; got != want {
+		t.Errorf("say with a URL = %q, want = %q", got, want)
+	}
+
+	sessions[2].Message.Reset()
+	sessions[1].StringCmd([]byte("tell BLUE see http://y\n"))
+	if got, want := printed(sessions[2]), "red2: see http://y\n"; got != want {
+		t.Errorf("tell with a URL = %q, want = %q", got, want)
+	}
+
+	lines := strings.Split(strings.TrimSpace(log.String()), "\n")
+	if got, want := len(lines), 6; got != want {
+		t.Fatalf("len(lines) = %d, want = %d", got, want)
+	}
+	if want := "tell red2 (10.0.0.2:26000) -> BLUE: nice shot"; !strings.HasSuffix(lines[2], want) {
+		t.Errorf("lines[2] = %q, want suffix %q", lines[2], want)
+	}
+}
+
+func TestStripControl(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"gg", "gg"},
+		{"a\nb\rc\x7f", "abc"},
+		{"\xe7\xe7 \x80\x9f", "\xe7\xe7 \x80\x9f"},
+		{"\xe8\x0a\xe9", "\xe8\xe9"},
+	} {
+		if got := stripControl(test.in); got != test.want {
+			t.Errorf("stripControl(%q) = %q, want = %q", test.in, got, test.want)
+		}
+	}
+}
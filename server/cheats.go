@@ -0,0 +1,118 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/matttproud/go-quake/command"
+	"github.com/matttproud/go-quake/cvar"
+
+	. "github.com/matttproud/go-quake/qtype"
+)
+
+type cheatVars struct {
+	cvCheats *cvar.Float
+}
+
+// cheatsAllowed reports whether clients may use the cheat commands.  The
+// server is always dedicated, so that there is no single player game in which
+// to allow them regardless: sv_cheats alone decides.
+func (s *Server) cheatsAllowed() bool {
+	return s.cvCheats.Get() != 0
+}
+
+// cheatCmd adapts a cheat command, which acts on the player's edict.
+func (s *Server) cheatCmd(name string, fn func(s *Session, e *Edict, args ...string)) command.Func {
+	return s.clientCmd(name, func(sess *Session, args ...string) error {
+		if !s.cheatsAllowed() {
+			sess.Printf("Cheats are not allowed on this server.\n")
+			return nil
+		}
+		if e := s.clientEdict(sess); e != nil && sess.Spawned {
+			fn(sess, e, args...)
+		}
+		return nil
+	})
+}
+
+// toggleFlag flips flag on e and reports whether it is now set.
+func toggleFlag(e *Edict, flag int) bool {
+	flags := int(e.V.Flags) ^ flag
+	e.V.Flags = Float(flags)
+	return flags&flag != 0
+}
+
+func onOff(on bool) string {
+	if on {
+		return "ON"
+	}
+	return "OFF"
+}
+
+func cmdGod(s *Session, e *Edict, args ...string) {
+	s.Printf("godmode %s\n", onOff(toggleFlag(e, flagGodMode)))
+}
+
+func cmdNoTarget(s *Session, e *Edict, args ...string) {
+	s.Printf("notarget %s\n", onOff(toggleFlag(e, flagNoTarget)))
+}
+
+func cmdNoClip(s *Session, e *Edict, args ...string) {
+	on := e.V.MoveType != moveTypeNoClip
+	if on {
+		e.V.MoveType = moveTypeNoClip
+	} else {
+		e.V.MoveType = moveTypeWalk
+	}
+	s.Printf("noclip %s\n", onOff(on))
+}
+
+func cmdFly(s *Session, e *Edict, args ...string) {
+	on := e.V.MoveType != moveTypeFly
+	if on {
+		e.V.MoveType = moveTypeFly
+	} else {
+		e.V.MoveType = moveTypeWalk
+	}
+	s.Printf("flymode %s\n", onOff(on))
+}
+
+// cmdGive follows Host_Give_f: a digit from 2 grants the weapon in that slot,
+// while s, n, r, c and h set the shells, nails, rockets, cells and health to
+// the value given.  k grants both keys.
+func cmdGive(s *Session, e *Edict, args ...string) {
+	if len(args) == 0 || args[0] == "" {
+		s.Printf("usage: give <item> [value]\n")
+		return
+	}
+	var v Float
+	if len(args) > 1 {
+		n, _ := strconv.Atoi(args[1])
+		v = Float(n)
+	}
+	switch t := args[0][0]; {
+	case t >= '2' && t <= '9':
+		e.V.Items = Float(int(e.V.Items) | itemShotgun<<(t-'2'))
+	case t == 's':
+		e.V.AmmoShells = v
+	case t == 'n':
+		e.V.AmmoNails = v
+	case t == 'r':
+		e.V.AmmoRockets = v
+	case t == 'c':
+		e.V.AmmoCells = v
+	case t == 'h':
+		e.V.Health = v
+	case t == 'k':
+		e.V.Items = Float(int(e.V.Items) | itemKey1 | itemKey2)
+	}
+}
+
+func (s *Server) initCheats() {
+	s.addCommand("god", s.cheatCmd("god", cmdGod), command.ClientCallable)
+	s.addCommand("notarget", s.cheatCmd("notarget", cmdNoTarget), command.ClientCallable)
+	s.addCommand("noclip", s.cheatCmd("noclip", cmdNoClip), command.ClientCallable)
+	s.addCommand("fly", s.cheatCmd("fly", cmdFly), command.ClientCallable)
+	s.addCommand("give", s.cheatCmd("give", cmdGive), command.ClientCallable)
+
+	s.cvCheats = s.newFloat("sv_cheats", 0, cvar.ServerSide)
+}
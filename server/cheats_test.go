@@ -0,0 +1,88 @@
+package server
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	. "github.com/matttproud/go-quake/qtype"
+)
+
+func TestCheats(t *testing.T) {
+	srv := newTestServer(t)
+	srv.MaxPlayers = 8
+	srv.Edicts = make([]Edict, 2)
+	sess, _ := newTestSession(srv, &recordingConn{})
+	sess.Spawned = true
+	sess.PassedAuth = true
+	srv.Sessions[sess.Id] = sess
+	v := &srv.Edicts[1].V
+
+	srv.cvCheats.Set(0)
+	srv.ExecClient(sess, []string{"god"})
+	if got, want := sess.Message.String(), "\x08Cheats are not allowed on this server.\n\x00"; got != want {
+		t.Errorf("god = %q, want = %q", got, want)
+	}
+	if v.Flags != 0 {
+		t.Errorf("flags = %v, want = 0", v.Flags)
+	}
+
+	srv.cvCheats.Set(1)
+	for _, args := range [][]string{
+		{"god"},
+		{"notarget"},
+		{"noclip"},
+		{"give", "5"},
+		{"give", "r", "25"},
+		{"give", "h", "999"},
+		{"give", "k"},
+	} {
+		srv.ExecClient(sess, args)
+	}
+	if got, want := v.Flags, Float(flagGodMode|flagNoTarget); got != want {
+		t.Errorf("flags = %v, want = %v", got, want)
+	}
+	if got, want := v.MoveType, Float(moveTypeNoClip); got != want {
+		t.Errorf("movetype = %v, want = %v", got, want)
+	}
+	if got, want := v.Items, Float(itemSuperNailgun|itemKey1|itemKey2); got != want {
+		t.Errorf("items = %v, want = %v", got, want)
+	}
+	if v.AmmoRockets != 25 || v.Health != 999 {
+		t.Errorf("rockets, health = %v, %v, want = 25, 999", v.AmmoRockets, v.Health)
+	}
+
+	srv.ExecClient(sess, []string{"fly"})
+	srv.ExecClient(sess, []string{"fly"})
+	if got, want := v.MoveType, Float(moveTypeWalk); got != want {
+		t.Errorf("movetype = %v, want = %v", got, want)
+	}
+}
+
+// TestCheatsDedicated checks that a server configured as netquakesrv
+// configures it does not allow cheats unless sv_cheats is set.
+func TestCheatsDedicated(t *testing.T) {
+	srv, err := New(Config{
+		Conn:    &recordingConn{},
+		Logger:  log.New(io.Discard, "", 0),
+		Console: io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Edicts = make([]Edict, 2)
+	sess, _ := newTestSession(srv, &recordingConn{})
+	sess.Spawned = true
+	sess.PassedAuth = true
+	srv.Sessions[sess.Id] = sess
+
+	srv.ExecClient(sess, []string{"god"})
+	if got := srv.Edicts[1].V.Flags; got != 0 {
+		t.Errorf("flags = %v, want = 0", got)
+	}
+	srv.cvCheats.Set(1)
+	srv.ExecClient(sess, []string{"god"})
+	if got, want := srv.Edicts[1].V.Flags, Float(flagGodMode); got != want {
+		t.Errorf("flags = %v, want = %v", got, want)
+	}
+}
@@ -0,0 +1,18 @@
+package server
+
+import "time"
+
+// Clock tells the server the time and schedules its frames.  Every timing
+// decision the server makes, from frame ticks to client timeouts and
+// reliable resends, is made against the Clock so that a fake one can drive
+// the server deterministically.
+type Clock interface {
+	Now() time.Time
+	// After sends the time on the returned channel once d has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
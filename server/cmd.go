@@ -0,0 +1,257 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/matttproud/go-quake/command"
+)
+
+// Cbuf is the command buffer.  Its contents are executed on the host frame.
+type Cbuf struct {
+	ops []func()
+	mtx sync.Mutex
+}
+
+func (b *Cbuf) Add(op func()) {
+	b.mtx.Lock()
+	b.ops = append(b.ops, op)
+	b.mtx.Unlock()
+}
+
+func (b *Cbuf) Execute() {
+	b.mtx.Lock()
+	ops := b.ops
+	b.ops = nil
+	b.mtx.Unlock()
+	for _, op := range ops {
+		op()
+	}
+}
+
+type errClientOnly string
+
+func (e errClientOnly) Error() string { return string(e) + " is not valid from the console" }
+
+// clientCmd adapts a command that only a client may run.
+func (s *Server) clientCmd(name string, fn func(s *Session, args ...string) error) command.Func {
+	return func(args ...string) error {
+		if s.hostClient == nil {
+			return errClientOnly(name)
+		}
+		return fn(s.hostClient, args...)
+	}
+}
+
+// logClientCommand is the default parseClientCommand.  Until the game VM
+// runs, the client commands that the engine does not handle are only logged.
+func (s *Server) logClientCommand(sess *Session, args []string) error {
+	s.log.Printf("%s tried to %s", sess.Player.Name, strings.Join(args, " "))
+	return nil
+}
+
+// clientConsole sends console output to a client.
+type clientConsole struct{ s *Session }
+
+func (c clientConsole) Write(p []byte) (int, error) {
+	c.s.Printf("%s", p)
+	return len(p), nil
+}
+
+// signonCommands are those that a client may run before it has given the
+// password and spawned.
+var signonCommands = map[string]bool{
+	"pass":     true,
+	"prespawn": true,
+	"spawn":    true,
+	"begin":    true,
+}
+
+// signonInfo are the commands that the stock client sends during signon,
+// which are held until it begins rather than refused.
+var signonInfo = []string{"name", "color"}
+
+// ExecClient runs a command on behalf of client s, as the game mode allows.
+// Only commands marked client-callable are run; their output and errors are
+// sent to the client.  Until the client has given the password and spawned,
+// only the signon commands are run.
+func (s *Server) ExecClient(sess *Session, args []string) error {
+	if len(args) > 0 && !(sess.PassedAuth && sess.Spawned) && !signonCommands[args[0]] {
+		for _, name := range signonInfo {
+			if args[0] == name {
+				if sess.signonInfo == nil {
+					sess.signonInfo = make(map[string][]string)
+				}
+				sess.signonInfo[name] = args
+				return nil
+			}
+		}
+		sess.Printf("%s not valid -- not spawned\n", args[0])
+		return nil
+	}
+	args, ok := s.mode().StringCmd(s, sess, args)
+	if !ok || len(args) == 0 {
+		return nil
+	}
+	fn, ok := s.Commands.FindFrom(args[0], command.SrcClient)
+	if !ok {
+		return s.parseClientCommand(sess, args)
+	}
+	prev := s.hostClient
+	s.hostClient = sess
+	restore := s.con.redirect(clientConsole{sess})
+	defer func() {
+		restore()
+		s.hostClient = prev
+	}()
+	if err := fn(args[1:]...); err != nil {
+		s.conPrintf("%v\n", err)
+	}
+	return nil
+}
+
+// AddText queues text for execution on the host frame, as Cbuf_AddText does.
+func (s *Server) AddText(text string) {
+	s.Cbuf.Add(func() {
+		if err := s.Exec(text); err != nil {
+			s.conPrintf("%v\n", err)
+		}
+	})
+}
+
+type errUnknownCommand string
+
+func (e errUnknownCommand) Error() string { return "Unknown command \"" + string(e) + "\"" }
+
+// Exec runs each of the semicolon- or newline-separated commands in text.
+// Text naming a console variable prints or sets it.
+func (s *Server) Exec(text string) error {
+	for _, line := range splitCommands(text) {
+		args := tokenize(line)
+		if len(args) == 0 {
+			continue
+		}
+		restore := s.withArgs(line)
+		err := s.execArgs(args)
+		restore()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withArgs makes the raw arguments of line those of the running command
+// and returns a func that restores the previous ones.
+func (s *Server) withArgs(line string) func() {
+	prev := s.cmdArgs
+	s.cmdArgs = skipArg(line)
+	return func() { s.cmdArgs = prev }
+}
+
+// argString returns the raw text of the command's arguments, which keeps
+// what tokenize would drop, such as a "//" in a URL.  Commands run without
+// a line get their arguments joined.
+func (s *Server) argString(args []string) string {
+	if s.cmdArgs == "" {
+		return strings.Join(args, " ")
+	}
+	return s.cmdArgs
+}
+
+// skipArg returns line without its first argument and the white space
+// around the rest.
+func skipArg(line string) string {
+	line = strings.Trim(line, " \t\r\n\x00")
+	if strings.HasPrefix(line, `"`) {
+		if i := strings.IndexByte(line[1:], '"'); i >= 0 {
+			line = line[i+2:]
+		} else {
+			line = ""
+		}
+	} else if i := strings.IndexAny(line, " \t\r\n\""); i >= 0 {
+		line = line[i:]
+	} else {
+		line = ""
+	}
+	return strings.TrimLeft(line, " \t\r\n")
+}
+
+func (s *Server) execArgs(args []string) error {
+	if fn, ok := s.Commands.Find(args[0]); ok {
+		return fn(args[1:]...)
+	}
+	cv, ok := s.Cvars.Lookup(args[0])
+	if !ok {
+		return errUnknownCommand(args[0])
+	}
+	if len(args) == 1 {
+		s.conPrintf("\"%s\" is \"%s\"\n", args[0], cv)
+		return nil
+	}
+	if err := cv.Parse(args[1]); err != nil {
+		return fmt.Errorf("%s: %v", args[0], err)
+	}
+	return nil
+}
+
+// splitCommands breaks text at semicolons and newlines outside of quotes.
+func splitCommands(text string) []string {
+	var (
+		out    []string
+		quoted bool
+		start  int
+	)
+	for i, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == '\n', r == ';' && !quoted:
+			out = append(out, text[start:i])
+			start = i + 1
+			quoted = false
+		}
+	}
+	if start < len(text) {
+		out = append(out, text[start:])
+	}
+	return out
+}
+
+// tokenize splits a command line into whitespace-separated arguments in the
+// manner of COM_Parse: quoted strings form a single argument and // begins a
+// comment.
+func tokenize(line string) []string {
+	var args []string
+	for {
+		line = strings.TrimLeft(line, " \t\r")
+		switch {
+		case line == "", strings.HasPrefix(line, "//"):
+			return args
+		case line[0] == '"':
+			end := strings.IndexByte(line[1:], '"')
+			if end == -1 {
+				return append(args, line[1:])
+			}
+			args = append(args, line[1:end+1])
+			line = line[end+2:]
+		default:
+			end := strings.IndexAny(line, " \t\r\"")
+			if end == -1 {
+				return append(args, line)
+			}
+			args = append(args, line[:end])
+			line = line[end:]
+		}
+	}
+}
+
+func (s *Server) initCmd() {
+	s.addCommand("stuffcmds", noImpl)
+	s.addCommand("exec", noImpl)
+	s.addCommand("echo", noImpl)
+	s.addCommand("alias", noImpl)
+	s.addCommand("cmd", noImpl)
+	s.addCommand("wait", noImpl)
+}
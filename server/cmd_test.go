@@ -0,0 +1,137 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		args []string
+	}{
+		{
+			line: "",
+			args: nil,
+		},
+		{
+			line: "  status ",
+			args: []string{"status"},
+		},
+		{
+			line: "kick # 2 \"spamming chat\"",
+			args: []string{"kick", "#", "2", "spamming chat"},
+		},
+		{
+			line: "hostname \"my server\" // comment",
+			args: []string{"hostname", "my server"},
+		},
+		{
+			line: "say \"unterminated",
+			args: []string{"say", "unterminated"},
+		},
+	} {
+		if got, want := tokenize(test.line), test.args; !reflect.DeepEqual(got, want) {
+			t.Errorf("tokenize(%q) = %q, want = %q", test.line, got, want)
+		}
+	}
+}
+
+func TestSplitCommands(t *testing.T) {
+	for _, test := range []struct {
+		text  string
+		lines []string
+	}{
+		{
+			text:  "",
+			lines: nil,
+		},
+		{
+			text:  "map e1m1",
+			lines: []string{"map e1m1"},
+		},
+		{
+			text:  "skill 3; map e1m1\nstatus\n",
+			lines: []string{"skill 3", " map e1m1", "status"},
+		},
+		{
+			text:  "say \"a;b\"; status",
+			lines: []string{"say \"a;b\"", " status"},
+		},
+	} {
+		if got, want := splitCommands(test.text), test.lines; !reflect.DeepEqual(got, want) {
+			t.Errorf("splitCommands(%q) = %q, want = %q", test.text, got, want)
+		}
+	}
+}
+
+func TestExecClient(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Bans = &BanList{}
+	sess, _ := newTestSession(srv, &recordingConn{})
+	sess.Player.Name = "Ranger"
+	sess.Spawned = true
+	sess.PassedAuth = true
+	srv.Sessions[sess.Id] = sess
+
+	var fellThrough []string
+	srv.parseClientCommand = func(s *Session, args []string) error {
+		fellThrough = args
+		return nil
+	}
+
+	if err := srv.ExecClient(sess, []string{"ban", "10.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fellThrough, []string{"ban", "10.0.0.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fell through with %q, want = %q", got, want)
+	}
+	if got := len(srv.Bans.Bans); got != 0 {
+		t.Errorf("client ran ban")
+	}
+
+	if err := srv.ExecClient(sess, []string{"ping"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sess.Message.String(), "\x08Client ping times:\n\x00\x08   0 Ranger\n\x00"; got != want {
+		t.Errorf("ping output = %q, want = %q", got, want)
+	}
+	if srv.hostClient != nil {
+		t.Error("srv.hostClient was not restored")
+	}
+
+	if err := srv.Exec("prespawn"); err == nil {
+		t.Error("prespawn ran from the console")
+	}
+}
+
+func TestExecClientBeforeSpawn(t *testing.T) {
+	srv := newTestServer(t)
+	srv.cvPausable.Set(1)
+	srv.cvPassword.Set("secret")
+	sess, _ := newTestSession(srv, &recordingConn{})
+	srv.Sessions[sess.Id] = sess
+
+	srv.ExecClient(sess, []string{"pause"})
+	if srv.Paused {
+		t.Error("client paused before giving the password")
+	}
+	if got, want := sess.Message.String(), "\x08pause not valid -- not spawned\n\x00"; got != want {
+		t.Errorf("message = %q, want = %q", got, want)
+	}
+	sess.Message.Reset()
+
+	srv.ExecClient(sess, []string{"name", "Ranger"})
+	if got := sess.Player.Name; got == "Ranger" {
+		t.Error("name was applied before the client began")
+	}
+	for _, args := range [][]string{{"pass", "secret"}, {"prespawn"}, {"spawn"}, {"begin"}} {
+		srv.ExecClient(sess, args)
+	}
+	if !sess.Spawned {
+		t.Fatal("client did not spawn after giving the password")
+	}
+	if got, want := sess.Player.Name, "Ranger"; got != want {
+		t.Errorf("name = %q, want = %q", got, want)
+	}
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"github.com/matttproud/go-quake/command"
+	"github.com/matttproud/go-quake/cvar"
+)
+
+func noImpl(...string) error {
+	return errors.New("not implemented")
+}
+
+// seconds converts a duration in seconds, as console variables give them.
+func seconds(f float32) time.Duration { return time.Duration(float64(f) * float64(time.Second)) }
+
+// addCommand, newFloat and newString register with the server's registries.
+// The first failure is kept for New to report.
+func (s *Server) addCommand(name string, fn command.Func, os ...command.Option) {
+	if err := s.Commands.Add(name, fn, os...); err != nil && s.initErr == nil {
+		s.initErr = err
+	}
+}
+
+func (s *Server) newFloat(name string, def float32, os ...cvar.Option) *cvar.Float {
+	cv, err := s.Cvars.NewFloat(name, def, os...)
+	if err != nil && s.initErr == nil {
+		s.initErr = err
+	}
+	return cv
+}
+
+func (s *Server) newString(name, def string, os ...cvar.Option) *cvar.String {
+	cv, err := s.Cvars.NewString(name, def, os...)
+	if err != nil && s.initErr == nil {
+		s.initErr = err
+	}
+	return cv
+}
+
+func (s *Server) initCommon() {
+	s.newFloat("registered", 0)
+	s.newString("cmdline", "", cvar.ServerSide)
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// console is the destination for command output.
+type console struct {
+	w   io.Writer
+	mtx sync.Mutex
+}
+
+func (s *Server) conPrintf(format string, args ...interface{}) {
+	s.con.mtx.Lock()
+	fmt.Fprintf(s.con.w, format, args...)
+	s.con.mtx.Unlock()
+}
+
+// redirect sends console output to w until the returned function is called.
+func (c *console) redirect(w io.Writer) (restore func()) {
+	c.mtx.Lock()
+	prev := c.w
+	c.w = w
+	c.mtx.Unlock()
+	return func() {
+		c.mtx.Lock()
+		c.w = prev
+		c.mtx.Unlock()
+	}
+}
+
+func (s *Server) initConsole() {
+	s.addCommand("toggleconsole", noImpl)
+	s.addCommand("messagemode", noImpl)
+	s.addCommand("messagemode2", noImpl)
+	s.addCommand("clear", noImpl)
+
+	s.newFloat("con_notifytime", 3)
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+
+	. "github.com/matttproud/go-quake/qtype"
+)
+
+// The event log records what happens in the game as JSON lines for external
+// statistics.  The game VM reports kills only through obituaries that it
+// prints with bprint and through changes to the frags of the players' edicts,
+// so these are gathered on each frame and matched up.
+//
+// No game VM runs yet: the engine puts each client's edict into the level,
+// but only the engine's own commands change its frags, and frags between
+// players and teamkills are not reported until a VM does.
+
+const eventFile = "events.jsonl"
+
+type eventPlayer struct {
+	Name string `json:"name"`
+	Slot int    `json:"slot"`
+	Addr string `json:"addr"`
+}
+
+type GameEvent struct {
+	Wall   time.Time    `json:"wall"`
+	Time   float64      `json:"time"` // seconds into the level
+	Map    string       `json:"map"`
+	Type   string       `json:"type"`
+	Player *eventPlayer `json:"player,omitempty"`
+	Target *eventPlayer `json:"target,omitempty"`
+	Text   string       `json:"text,omitempty"`
+}
+
+func identify(sess *Session) *eventPlayer {
+	if sess == nil {
+		return nil
+	}
+	return &eventPlayer{Name: sess.Player.Name, Slot: sess.Slot, Addr: sess.RemoteAddr.String()}
+}
+
+// logEvent records an event by player, if any, against target, if any, and
+// counts it in the statistics unless a client involved has no name yet.
+func (s *Server) logEvent(typ string, player, target *Session, text string) {
+	ev := GameEvent{
+		Wall:   s.clock.Now().UTC(),
+		Time:   s.Time.Seconds(),
+		Map:    s.Map,
+		Type:   typ,
+		Player: identify(player),
+		Target: identify(target),
+		Text:   text,
+	}
+	if (player == nil || named(player)) && (target == nil || named(target)) {
+		s.Stats.Record(&ev)
+	}
+	if s.Events == nil {
+		return
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		s.log.Println(err)
+		return
+	}
+	if _, err := s.Events.Write(append(b, '\n')); err != nil {
+		s.log.Println(err)
+	}
+}
+
+// Bprint prints text to everyone as the bprint builtin does, noting complete
+// lines as possible obituaries.  Everything broadcast to the consoles passes
+// through it.
+func (s *Server) Bprint(text string) {
+	var m Message
+	m.WriteByte(protonetquake.SVCPrint)
+	m.WriteCString(text)
+	s.Reliable(m.Bytes())
+	s.bprinted += text
+	for {
+		i := strings.IndexByte(s.bprinted, '\n')
+		if i < 0 {
+			return
+		}
+		s.obituaries = append(s.obituaries, s.bprinted[:i])
+		s.bprinted = s.bprinted[i+1:]
+	}
+}
+
+// Sprint prints text to sess as the sprint builtin does, noting the lines
+// that announce item pickups.  Everything printed to a client's console but
+// chat passes through it.
+func (s *Server) Sprint(sess *Session, text string) {
+	sess.print(text)
+	sess.Player.sprinted += text
+	for {
+		i := strings.IndexByte(sess.Player.sprinted, '\n')
+		if i < 0 {
+			return
+		}
+		line := sess.Player.sprinted[:i]
+		sess.Player.sprinted = sess.Player.sprinted[i+1:]
+		if strings.HasPrefix(line, "You got ") || strings.HasPrefix(line, "You receive ") {
+			s.logEvent("item", sess, nil, line)
+		}
+	}
+}
+
+// namedAt returns the player whose name is the longest prefix of text.
+func (s *Server) namedAt(text string) *Session {
+	var found *Session
+	for _, sess := range s.Sessions {
+		name := sess.Player.Name
+		if strings.HasPrefix(text, name) && (found == nil || len(name) > len(found.Player.Name)) {
+			found = sess
+		}
+	}
+	return found
+}
+
+// syncFrags copies the frags of the players' edicts, as the game mode
+// allows, telling everyone of the changes as SV_UpdateToReliableMessages does
+// and logging the kills that they reveal.
+func (s *Server) syncFrags() {
+	obituaries := s.obituaries
+	s.obituaries = nil
+	for _, sess := range s.Sessions.Sorted() {
+		e := s.clientEdict(sess)
+		if e == nil || int(e.V.Frags) == sess.Player.Frags {
+			continue
+		}
+		delta := int(e.V.Frags) - sess.Player.Frags
+		typ, victim, text := s.classifyFrag(sess, delta, obituaries)
+		delta = s.mode().Frag(s, typ, sess, victim, delta)
+		sess.Player.Frags += delta
+		e.V.Frags = Float(sess.Player.Frags)
+		if delta == 0 {
+			continue
+		}
+		var m Message
+		sess.updateFrags(&m)
+		s.Reliable(m.Bytes())
+		s.logEvent(typ, sess, victim, text)
+	}
+}
+
+// teamKills are the obituaries of ClientObituary that follow the name of a
+// player who has killed a teammate.
+var teamKills = []string{
+	" mows down a teammate",
+	" checks his glasses",
+	" gets a frag for the other team",
+	" loses another friend",
+}
+
+// classifyFrag identifies the kind of kill by sess that changed its frags by
+// delta and its victim, if known, from the obituary that names it.
+// Obituaries begin with the name of the victim and, for a frag, go on to name
+// the killer.
+func (s *Server) classifyFrag(sess *Session, delta int, obituaries []string) (typ string, victim *Session, text string) {
+	for _, line := range obituaries {
+		subject := s.namedAt(line)
+		switch {
+		case delta > 0 && subject != nil && subject != sess && strings.Contains(line[len(subject.Player.Name):], sess.Player.Name):
+			return "frag", subject, line
+		case delta < 0 && subject == sess:
+			for _, tk := range teamKills {
+				if strings.HasPrefix(line[len(sess.Player.Name):], tk) {
+					return "teamkill", nil, line
+				}
+			}
+			return "suicide", nil, line
+		}
+	}
+	if delta < 0 {
+		return "suicide", nil, ""
+	}
+	return "frag", nil, ""
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestEventLog(t *testing.T) {
+	var events bytes.Buffer
+	srv := newTestServer(t)
+	srv.Map = "dm3"
+	srv.Edicts = make([]Edict, 3)
+	srv.Events = &events
+	var players []*Session
+	for i, name := range []string{"alice", "bob"} {
+		sess, _ := newTestSession(srv, &recordingConn{})
+		sess.Id = name
+		sess.Slot = i
+		sess.Player.Name = name
+		sess.Spawned = true
+		sess.PassedAuth = true
+		srv.Sessions[name] = sess
+		players = append(players, sess)
+	}
+	now := time.Unix(100, 0)
+	frame := func() {
+		now = now.Add(time.Second)
+		srv.Frame(now)
+	}
+	frame()
+
+	srv.Bprint("bob")
+	srv.Bprint(" was ax-murdered by ")
+	srv.Bprint("alice\n")
+	srv.Edicts[1].V.Frags = 1
+	frame()
+
+	srv.BroadcastPrintf("%s becomes bored with life\n", "bob")
+	srv.Edicts[2].V.Frags = -1
+	frame()
+
+	srv.Bprint("alice mows down a teammate\n")
+	srv.Edicts[1].V.Frags = 0
+	frame()
+
+	srv.Sprint(players[1], "You got the ")
+	players[1].Printf("%s\n", "Rocket Launcher")
+	srv.Sprint(players[1], "You can't carry any more\n")
+	srv.ExecClient(players[0], []string{"tell", "bob", "You", "got", "the", "Quad"})
+
+	dec := json.NewDecoder(&events)
+	for i, want := range []struct {
+		typ, player, target string
+	}{
+		{"frag", "alice", "bob"},
+		{"suicide", "bob", ""},
+		{"teamkill", "alice", ""},
+		{"item", "bob", ""},
+		{"tell", "alice", ""},
+	} {
+		var ev GameEvent
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		if ev.Type != want.typ || ev.Player == nil || ev.Player.Name != want.player {
+			t.Errorf("event %d = %+v, want %s by %s", i, ev, want.typ, want.player)
+		}
+		var target string
+		if ev.Target != nil {
+			target = ev.Target.Name
+		}
+		if target != want.target {
+			t.Errorf("event %d target = %q, want = %q", i, target, want.target)
+		}
+		if ev.Map != "dm3" {
+			t.Errorf("event %d map = %q, want = %q", i, ev.Map, "dm3")
+		}
+	}
+	if dec.More() {
+		t.Error("unexpected events follow")
+	}
+	if got, want := players[0].Player.Frags, 0; got != want {
+		t.Errorf("alice's frags = %d, want = %d", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net"
+	"sort"
+
+	"github.com/matttproud/go-quake/cvar"
+)
+
+// Game modes customize the rules of the game in Go alongside the game VM.
+// The mode named by sv_gamemode receives each hook; hooks may veto or modify
+// what they are told of.
+
+type gameModeVars struct {
+	cvGameMode *cvar.String
+}
+
+type GameMode interface {
+	// FrameStart and FrameEnd bracket each host frame.
+	FrameStart(s *Server)
+	FrameEnd(s *Server)
+	// ClientConnect is told of a connection request and may refuse it by
+	// returning the reason to give the client.
+	ClientConnect(s *Server, addr net.Addr) (reject string)
+	ClientDisconnect(s *Server, sess *Session)
+	// StringCmd may rewrite a client's command or veto it by returning false.
+	StringCmd(s *Server, sess *Session, args []string) ([]string, bool)
+	// Spawn may veto the spawning of an entity.
+	Spawn(s *Server, e *Edict) bool
+	// Damage returns the damage that attacker does to target, which is zero
+	// to veto it.
+	Damage(s *Server, target, attacker *Edict, damage float32) float32
+	// Frag returns the change in the killer's frags from a kill of the kind
+	// given: "frag", "suicide" or "teamkill".  The victim may be unknown.
+	Frag(s *Server, typ string, killer, victim *Session, delta int) int
+}
+
+// NopMode leaves the game as it is.  Embed it in a game mode to implement
+// only some hooks.
+type NopMode struct{}
+
+func (NopMode) FrameStart(*Server)                               {}
+func (NopMode) FrameEnd(*Server)                                 {}
+func (NopMode) ClientConnect(*Server, net.Addr) string           { return "" }
+func (NopMode) ClientDisconnect(*Server, *Session)               {}
+func (NopMode) Spawn(*Server, *Edict) bool                       { return true }
+func (NopMode) Damage(_ *Server, _, _ *Edict, d float32) float32 { return d }
+
+func (NopMode) StringCmd(_ *Server, _ *Session, args []string) ([]string, bool) { return args, true }
+
+func (NopMode) Frag(_ *Server, _ string, _, _ *Session, delta int) int { return delta }
+
+type errGameModeRegistered string
+
+func (e errGameModeRegistered) Error() string {
+	return "game mode " + string(e) + " is already registered"
+}
+
+// RegisterGameMode makes a game mode available under name.  It must be
+// called before Loop or on the frame.
+func (s *Server) RegisterGameMode(name string, m GameMode) error {
+	if _, ok := s.gameModes[name]; ok {
+		return errGameModeRegistered(name)
+	}
+	s.gameModes[name] = m
+	return nil
+}
+
+// mode returns the game mode in effect.
+func (s *Server) mode() GameMode {
+	if m, ok := s.gameModes[s.cvGameMode.Get()]; ok {
+		return m
+	}
+	return NopMode{}
+}
+
+// Spawn reports whether e may be spawned.
+func (s *Server) Spawn(e *Edict) bool { return s.mode().Spawn(s, e) }
+
+// Damage returns the damage that attacker should do to target.
+func (s *Server) Damage(target, attacker *Edict, damage float32) float32 {
+	return s.mode().Damage(s, target, attacker, damage)
+}
+
+func (s *Server) cmdGameModes(args ...string) error {
+	names := make([]string, 0, len(s.gameModes))
+	for n := range s.gameModes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		mark := " "
+		if n == s.cvGameMode.Get() {
+			mark = "*"
+		}
+		s.conPrintf("%s %s\n", mark, n)
+	}
+	return nil
+}
+
+func (s *Server) initGameMode() {
+	s.gameModes = make(map[string]GameMode)
+	s.addCommand("gamemodes", s.cmdGameModes)
+
+	s.cvGameMode = s.newString("sv_gamemode", "", cvar.ServerSide)
+}
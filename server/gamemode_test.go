@@ -0,0 +1,150 @@
+package server
+
+import (
+	"io"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/matttproud/go-quake/qtype"
+)
+
+// testMode doubles frags, forgives suicides and turns "say" into "say_team".
+type testMode struct {
+	NopMode
+	frames int
+}
+
+func (m *testMode) FrameEnd(*Server) { m.frames++ }
+
+func (m *testMode) StringCmd(_ *Server, _ *Session, args []string) ([]string, bool) {
+	switch args[0] {
+	case "kill":
+		return nil, false
+	case "say":
+		return append([]string{"say_team"}, args[1:]...), true
+	}
+	return args, true
+}
+
+func (m *testMode) Frag(_ *Server, typ string, _, _ *Session, delta int) int {
+	if typ == "suicide" {
+		return 0
+	}
+	return 2 * delta
+}
+
+func TestGameMode(t *testing.T) {
+	mode := new(testMode)
+	srv, err := New(Config{
+		Logger:    log.New(io.Discard, "", 0),
+		Console:   io.Discard,
+		GameModes: map[string]GameMode{"test": mode},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.RegisterGameMode("test", mode); err == nil {
+		t.Error("duplicate registration succeeded")
+	}
+	if other := newTestServer(t); other.RegisterGameMode("test", mode) != nil {
+		t.Error("game mode registered with another server")
+	}
+	srv.Edicts = make([]Edict, 3)
+	srv.cvGameMode.Set("test")
+	srv.cvTeamplay.Set(1)
+	var players []*Session
+	for i, name := range []string{"alice", "bob"} {
+		sess, _ := newTestSession(srv, &recordingConn{})
+		sess.Id = name
+		sess.Slot = i
+		sess.Player = Player{Name: name, Team: i}
+		sess.Spawned = true
+		sess.PassedAuth = true
+		srv.Sessions[name] = sess
+		players = append(players, sess)
+	}
+
+	srv.ExecClient(players[0], []string{"say", "hello"})
+	if got := players[1].Message.Len(); got != 0 {
+		t.Errorf("say reached the other team")
+	}
+	if got := players[0].Message.Len(); got == 0 {
+		t.Errorf("say_team did not reach the team")
+	}
+
+	players[0].Message.Reset()
+	srv.ExecClient(players[0], []string{"kill"})
+	if got := players[0].Message.Len(); got != 0 {
+		t.Errorf("vetoed kill ran")
+	}
+
+	now := time.Unix(100, 0)
+	srv.Bprint("bob was gibbed by alice's rocket\n")
+	srv.Edicts[1].V.Frags = 1
+	srv.Frame(now)
+	srv.Bprint("bob becomes bored with life\n")
+	srv.Edicts[2].V.Frags = -1
+	srv.Frame(now.Add(time.Second))
+	if got, want := players[0].Player.Frags, 2; got != want {
+		t.Errorf("alice's frags = %d, want = %d", got, want)
+	}
+	if got, want := srv.Edicts[1].V.Frags, Float(2); got != want {
+		t.Errorf("alice's edict frags = %v, want = %v", got, want)
+	}
+	if got, want := players[1].Player.Frags, 0; got != want {
+		t.Errorf("bob's frags = %d, want = %d", got, want)
+	}
+	if got, want := mode.frames, 2; got != want {
+		t.Errorf("frames = %d, want = %d", got, want)
+	}
+}
+
+// armoredMode counts spawns and lets no damage through.
+type armoredMode struct {
+	NopMode
+	spawns int
+	damage []float32
+}
+
+func (m *armoredMode) Spawn(*Server, *Edict) bool { m.spawns++; return true }
+
+func (m *armoredMode) Damage(_ *Server, _, _ *Edict, d float32) float32 {
+	m.damage = append(m.damage, d)
+	return 0
+}
+
+func TestGameModeSpawnAndDamage(t *testing.T) {
+	mode := new(armoredMode)
+	srv, err := New(Config{
+		Logger:    log.New(io.Discard, "", 0),
+		Console:   io.Discard,
+		GameModes: map[string]GameMode{"armored": mode},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.cvGameMode.Set("armored")
+	sess, _ := newTestSession(srv, &recordingConn{})
+	sess.Player.Name = "Ranger"
+	srv.Sessions[sess.Id] = sess
+	for _, cmd := range []string{"prespawn", "spawn", "begin"} {
+		srv.ExecClient(sess, []string{cmd})
+	}
+	if got, want := mode.spawns, 1; got != want {
+		t.Errorf("spawns = %d, want = %d", got, want)
+	}
+
+	sess.Message.Reset()
+	srv.ExecClient(sess, []string{"kill"})
+	if got, want := mode.damage, []float32{100}; !reflect.DeepEqual(got, want) {
+		t.Errorf("damage = %v, want = %v", got, want)
+	}
+	if got := sess.Message.String(); got != "" {
+		t.Errorf("vetoed kill printed %q", got)
+	}
+	if got, want := srv.clientEdict(sess).V.Health, Float(100); got != want {
+		t.Errorf("health = %v, want = %v", got, want)
+	}
+}
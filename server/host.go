@@ -0,0 +1,35 @@
+package server
+
+import "github.com/matttproud/go-quake/cvar"
+
+type hostVars struct {
+	sysTicRate   *cvar.Float
+	cvDeathmatch *cvar.Float
+	cvCoop       *cvar.Float
+	cvPausable   *cvar.Float
+}
+
+func (s *Server) initHost() {
+	s.newFloat("host_framerate", 0)
+	s.newFloat("host_speeds", 0)
+
+	s.sysTicRate = s.newFloat("sys_ticrate", 0.05)
+	s.newFloat("serverprofile", 0)
+
+	s.cvFragLimit = s.newFloat("fraglimit", 0, cvar.ServerSide)
+	s.cvTimeLimit = s.newFloat("timelimit", 0, cvar.ServerSide)
+	s.cvTeamplay = s.newFloat("teamplay", 0, cvar.ServerSide)
+
+	s.cvSameLevel = s.newFloat("samelevel", 0)
+	s.cvNoExit = s.newFloat("noexit", 0, cvar.ServerSide)
+
+	s.newFloat("developer", 0)
+
+	s.newFloat("skill", 1)
+	s.cvDeathmatch = s.newFloat("deathmatch", 0)
+	s.cvCoop = s.newFloat("coop", 0)
+
+	s.cvPausable = s.newFloat("pausable", 1)
+
+	s.newFloat("temp1", 0)
+}
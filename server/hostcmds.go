@@ -0,0 +1,287 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matttproud/go-quake/command"
+	"github.com/matttproud/go-quake/cvar"
+	"github.com/matttproud/go-quake/proto/protonetquake"
+
+	. "github.com/matttproud/go-quake/qtype"
+)
+
+type infoVars struct {
+	cvInfoDelay *cvar.Float
+}
+
+func (s *Server) cmdStatus(args ...string) error {
+	s.conPrintf("host:    %s\n", s.cvHostname.Get())
+	s.conPrintf("version: 1.09\n")
+	if s.Conn != nil {
+		s.conPrintf("tcp/ip:  %s\n", s.Conn.LocalAddr())
+	}
+	s.conPrintf("map:     %s\n", s.Map)
+	s.conPrintf("players: %d active (%d max)\n\n", s.Sessions.Len(), s.MaxPlayers)
+	for _, sess := range s.Sessions.Sorted() {
+		p := &sess.Player
+		d := s.clock.Now().Sub(p.ConnectTime)
+		hours, minutes, seconds := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+		s.conPrintf("#%-2d %-16.16s  %3d  %4dms  %2d:%02d:%02d\n",
+			sess.Slot+1, p.Name, p.Frags, int(p.Ping()*1000), hours, minutes, seconds)
+		s.conPrintf("   %s\n", sess.RemoteAddr)
+	}
+	return nil
+}
+
+// findClient finds the session named by the arguments of kick and similar
+// commands, which is either a player name or "#" followed by a slot number.
+// The arguments that follow are returned.
+func (s *Server) findClient(args []string) (*Session, []string, error) {
+	if len(args) >= 2 && args[0] == "#" {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid slot %q", args[1])
+		}
+		for _, sess := range s.Sessions {
+			if sess.Slot+1 == n {
+				return sess, args[2:], nil
+			}
+		}
+		return nil, nil, fmt.Errorf("no player in slot %d", n)
+	}
+	for _, sess := range s.Sessions {
+		if strings.EqualFold(sess.Player.Name, args[0]) {
+			return sess, args[1:], nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no player named %q", args[0])
+}
+
+// Kick drops the client with a message naming who kicked it and why.
+func (s *Server) Kick(sess *Session, by, reason string) {
+	msg := "Kicked by " + by
+	if reason != "" {
+		msg += ": " + reason
+	}
+	s.conPrintf("%s was kicked\n", sess.Player.Name)
+	sess.Drop(msg + "\n")
+}
+
+func (s *Server) cmdKick(args ...string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: kick <name> [reason] or kick # <slot> [reason]")
+	}
+	sess, rest, err := s.findClient(args)
+	if err != nil {
+		return err
+	}
+	s.Kick(sess, "Console", strings.Join(rest, " "))
+	return nil
+}
+
+func (s *Server) cmdPing(args ...string) error {
+	s.conPrintf("Client ping times:\n")
+	for _, sess := range s.Sessions.Sorted() {
+		s.conPrintf("%4d %s\n", int(sess.Player.Ping()*1000), sess.Player.Name)
+	}
+	return nil
+}
+
+const maxNameLen = 15
+
+// sanitizeName strips the characters that would corrupt the name's display or
+// the commands in which it is quoted.
+func sanitizeName(name string) string {
+	b := make([]byte, 0, len(name))
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; {
+		case c < ' ', c == 127, c == '"', c == ';':
+		default:
+			b = append(b, c)
+		}
+	}
+	if len(b) > maxNameLen {
+		b = b[:maxNameLen]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// infoChangeAllowed reports whether the client may change its name or colors,
+// which it may do freely while joining and every sv_infodelay seconds after.
+func infoChangeAllowed(s *Session, now time.Time) bool {
+	if !s.Spawned {
+		return true
+	}
+	delay := seconds(s.srv.cvInfoDelay.Get())
+	if now.Sub(s.Player.lastInfoChange) < delay {
+		s.Printf("You can't change your name or color so often.\n")
+		return false
+	}
+	s.Player.lastInfoChange = now
+	return true
+}
+
+func (s *Session) updateName(m *Message) {
+	m.WriteByte(protonetquake.SVCUpdateName)
+	m.WriteByte(byte(s.Slot))
+	m.WriteCString(s.Player.Name)
+}
+
+func (s *Session) updateColors(m *Message) {
+	m.WriteByte(protonetquake.SVCUpdateColors)
+	m.WriteByte(byte(s.Slot))
+	m.WriteByte(byte(s.Player.Colors))
+}
+
+func (s *Session) updateFrags(m *Message) {
+	m.WriteByte(protonetquake.SVCUpdateFrags)
+	m.WriteByte(byte(s.Slot))
+	m.WriteShort(int16(s.Player.Frags))
+}
+
+func cmdName(s *Session, args ...string) error {
+	if len(args) == 0 {
+		s.Printf("\"name\" is \"%s\"\n", s.Player.Name)
+		return nil
+	}
+	name := sanitizeName(strings.Join(args, " "))
+	if name == "" || name == s.Player.Name || !infoChangeAllowed(s, s.srv.clock.Now()) {
+		return nil
+	}
+	if s.Player.Name != "unconnected" {
+		s.srv.Bprint(s.Player.Name + " renamed to " + name + "\n")
+	}
+	if s.Spawned {
+		// Credit the time played so far to the old name.
+		s.srv.Stats.AddPlayTime(s, s.srv.clock.Now())
+	}
+	s.Player.Name = name
+	if e := s.srv.clientEdict(s); e != nil {
+		e.V.NetName = s.srv.progStrings.Set(name)
+	}
+	var m Message
+	s.updateName(&m)
+	s.srv.Reliable(m.Bytes())
+	return nil
+}
+
+func cmdColor(s *Session, args ...string) error {
+	if len(args) == 0 {
+		s.Printf("\"color\" is \"%d %d\"\n", s.Player.Colors>>4, s.Player.Colors&15)
+		return nil
+	}
+	top, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("usage: color <0-13> [0-13]")
+	}
+	bottom := top
+	if len(args) > 1 {
+		if bottom, err = strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("usage: color <0-13> [0-13]")
+		}
+	}
+	clamp := func(c int) int {
+		if c &= 15; c > 13 {
+			c = 13
+		}
+		return c
+	}
+	colors := clamp(top)<<4 | clamp(bottom)
+	if colors == s.Player.Colors || !infoChangeAllowed(s, s.srv.clock.Now()) {
+		return nil
+	}
+	s.Player.Colors = colors
+	s.Player.Team = clamp(bottom) + 1
+	if e := s.srv.clientEdict(s); e != nil {
+		// The colormap names the player whose colors the entity wears.
+		e.V.ColorMap = Float(s.Slot + 1)
+		e.V.Team = Float(s.Player.Team)
+	}
+	var m Message
+	s.updateColors(&m)
+	s.srv.Reliable(m.Bytes())
+	return nil
+}
+
+// cmdKill follows Host_Kill_f and, in place of the game VM, its ClientKill:
+// the player takes its health in damage, loses two frags and is put back
+// into the level.
+func cmdKill(s *Session, args ...string) error {
+	e := s.srv.clientEdict(s)
+	if e == nil {
+		return nil
+	}
+	if e.V.Health <= 0 {
+		s.Printf("Can't suicide -- allready dead!\n")
+		return nil
+	}
+	if !s.srv.damage(e, e, float32(e.V.Health)) {
+		return nil
+	}
+	s.srv.Bprint(s.Player.Name + " suicides\n")
+	frags := e.V.Frags - 2
+	s.srv.spawnEdict(s)
+	if e := s.srv.clientEdict(s); e != nil {
+		e.V.Frags = frags
+	}
+	return nil
+}
+
+// SetPause pauses or resumes the game on behalf of by.
+func (s *Server) SetPause(paused bool, by string) {
+	if s.Paused == paused {
+		return
+	}
+	s.Paused = paused
+	text, state := by+" paused the game\n", byte(1)
+	if !paused {
+		text, state = by+" unpaused the game\n", 0
+	}
+	s.Bprint(text)
+	var m Message
+	m.WriteByte(protonetquake.SVCSetPause)
+	m.WriteByte(state)
+	s.Reliable(m.Bytes())
+	s.log.Print(text)
+}
+
+func (s *Server) cmdPause(args ...string) error {
+	if s.hostClient != nil && s.cvPausable.Get() == 0 {
+		s.hostClient.Printf("Pause not allowed.\n")
+		return nil
+	}
+	s.SetPause(!s.Paused, s.speaker(s.hostClient))
+	return nil
+}
+
+func (s *Server) initHostCmds() {
+	s.addCommand("status", s.cmdStatus, command.ClientCallable)
+	s.addCommand("quit", noImpl)
+	s.addCommand("map", noImpl)
+	s.addCommand("changelevel2", noImpl)
+	s.addCommand("connect", noImpl)
+	s.addCommand("reconnect", noImpl)
+	s.addCommand("name", s.clientCmd("name", cmdName), command.ClientCallable)
+	s.addCommand("version", noImpl)
+	s.addCommand("please", noImpl)
+	s.addCommand("color", s.clientCmd("color", cmdColor), command.ClientCallable)
+	s.addCommand("kill", s.clientCmd("kill", cmdKill), command.ClientCallable)
+	s.addCommand("pause", s.cmdPause, command.ClientCallable)
+	s.addCommand("kick", s.cmdKick)
+	s.addCommand("ping", s.cmdPing, command.ClientCallable)
+	s.addCommand("load", noImpl)
+	s.addCommand("save", noImpl)
+	s.addCommand("startdemos", noImpl)
+	s.addCommand("demos", noImpl)
+	s.addCommand("stopdemo", noImpl)
+	s.addCommand("viewmodel", noImpl)
+	s.addCommand("viewframe", noImpl)
+	s.addCommand("viewnext", noImpl)
+	s.addCommand("viewprev", noImpl)
+	s.addCommand("mcache", noImpl)
+
+	s.cvInfoDelay = s.newFloat("sv_infodelay", 5)
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+	. "github.com/matttproud/go-quake/qtype"
+)
+
+func TestPlayerPing(t *testing.T) {
+	var p Player
+	if got, want := p.Ping(), float32(0); got != want {
+		t.Errorf("p.Ping() = %v, want = %v", got, want)
+	}
+	p.AddPing(.1)
+	p.AddPing(.3)
+	if got, want := p.Ping(), float32(.2); got != want {
+		t.Errorf("p.Ping() = %v, want = %v", got, want)
+	}
+	for i := 0; i < numPingTimes; i++ {
+		p.AddPing(.5)
+	}
+	if got, want := p.Ping(), float32(.5); got != want {
+		t.Errorf("p.Ping() = %v, want = %v", got, want)
+	}
+}
+
+func TestStatusWithoutConn(t *testing.T) {
+	srv := newTestServer(t)
+	if err := srv.cmdStatus(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNameColorEdict(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Edicts = make([]Edict, 3)
+	sess, _ := newTestSession(srv, &recordingConn{})
+	sess.Slot = 1
+	srv.Sessions[sess.Id] = sess
+	if err := cmdName(sess, "Ranger"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmdColor(sess, "4", "12"); err != nil {
+		t.Fatal(err)
+	}
+	v := &srv.Edicts[2].V
+	if got, want := srv.progStrings.Get(v.NetName), "Ranger"; got != want {
+		t.Errorf("netname = %q, want = %q", got, want)
+	}
+	if got, want := v.ColorMap, Float(2); got != want {
+		t.Errorf("colormap = %v, want = %v", got, want)
+	}
+	if got, want := v.Team, Float(13); got != want {
+		t.Errorf("team = %v, want = %v", got, want)
+	}
+}
+
+func TestKick(t *testing.T) {
+	srv := newTestServer(t)
+	conn := &recordingConn{}
+	sess, removed := newTestSession(srv, conn)
+	sess.Slot = 2
+	sess.Player.Name = "Ranger"
+	srv.Sessions[sess.Id] = sess
+
+	for _, args := range [][]string{{"nobody"}, {"#", "1"}, {"#", "x"}} {
+		if err := srv.cmdKick(args...); err == nil {
+			t.Errorf("cmdKick(%q) succeeded", args)
+		}
+	}
+	if *removed {
+		t.Fatal("session was removed")
+	}
+	if err := srv.cmdKick("#", "3", "camping", "too", "much"); err != nil {
+		t.Fatal(err)
+	}
+	if !*removed {
+		t.Fatal("session was not removed")
+	}
+	got := string(conn.writes[0][protonetquake.NetHeaderSize:])
+	if want := "\x08Kicked by Console: camping too much\n\x00\x02"; got != want {
+		t.Errorf("drop message = %q, want = %q", got, want)
+	}
+
+	*removed = false
+	if err := srv.cmdKick("ranger"); err != nil {
+		t.Fatal(err)
+	}
+	if !*removed {
+		t.Error("session was not removed by name")
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	for _, test := range []struct{ in, want string }{
+		{"Ranger", "Ranger"},
+		{"  spaced  ", "spaced"},
+		{"bad\";quit\n", "badquit"},
+		{"a-very-long-player-name", "a-very-long-pla"},
+		{"\x01\x02", ""},
+		{"\x80\xe1\xec", "\x80\xe1\xec"},
+	} {
+		if got := sanitizeName(test.in); got != test.want {
+			t.Errorf("sanitizeName(%q) = %q, want = %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestNameAndColor(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Edicts = make([]Edict, 3)
+	self, _ := newTestSession(srv, &recordingConn{})
+	self.Slot = 1
+	self.Player.Name = "Scout"
+	self.Spawned = true
+	self.PassedAuth = true
+	other, _ := newTestSession(srv, &recordingConn{})
+	other.Id = "other"
+	srv.Sessions[self.Id] = self
+	srv.Sessions[other.Id] = other
+
+	srv.ExecClient(self, []string{"name", "Ranger"})
+	if got, want := other.Message.String(), "\x08Scout renamed to Ranger\n\x00\x0d\x01Ranger\x00"; got != want {
+		t.Errorf("update = %q, want = %q", got, want)
+	}
+	other.Message.Reset()
+
+	srv.ExecClient(self, []string{"color", "4", "15"})
+	if got, want := other.Message.String(), ""; got != want {
+		t.Errorf("rate limited update = %q, want = %q", got, want)
+	}
+	self.Player.lastInfoChange = time.Time{}
+	srv.ExecClient(self, []string{"color", "4", "15"})
+	if got, want := other.Message.String(), "\x11\x01\x4d"; got != want {
+		t.Errorf("update = %q, want = %q", got, want)
+	}
+	if got, want := srv.Edicts[2].V.Team, Float(14); got != want {
+		t.Errorf("team = %v, want = %v", got, want)
+	}
+}
+
+func TestPause(t *testing.T) {
+	srv := newTestServer(t)
+	conn := &recordingConn{}
+	sess, _ := newTestSession(srv, conn)
+	sess.Player.Name = "Ranger"
+	sess.Spawned = true
+	sess.PassedAuth = true
+	srv.Sessions[sess.Id] = sess
+
+	srv.cvPausable.Set(0)
+	srv.ExecClient(sess, []string{"pause"})
+	if srv.Paused {
+		t.Fatal("paused while not pausable")
+	}
+	sess.Message.Reset()
+
+	srv.cvPausable.Set(1)
+	srv.ExecClient(sess, []string{"pause"})
+	if !srv.Paused {
+		t.Fatal("not paused")
+	}
+	if got, want := sess.Message.String(), "\x08Ranger paused the game\n\x00\x18\x01"; got != want {
+		t.Errorf("message = %q, want = %q", got, want)
+	}
+	sess.Message.Reset()
+
+	start := time.Unix(100, 0)
+	sess.lastMessage = start
+	srv.Frame(start)
+	srv.Frame(start.Add(2 * time.Second))
+	srv.Frame(start.Add(10 * time.Second))
+	if srv.Time != 0 {
+		t.Errorf("srv.Time = %v while paused", srv.Time)
+	}
+	var nops int
+	for _, w := range conn.writes {
+		if string(w[protonetquake.NetHeaderSize:]) == "\x01" {
+			nops++
+		}
+	}
+	if got, want := nops, 2; got != want {
+		t.Errorf("sent %d nops, want = %d", got, want)
+	}
+
+	srv.ExecClient(sess, []string{"pause"})
+	srv.Frame(start.Add(11 * time.Second))
+	if got, want := srv.Time, time.Second; got != want {
+		t.Errorf("srv.Time = %v, want = %v", got, want)
+	}
+}
+
+func TestKill(t *testing.T) {
+	srv := newTestServer(t)
+	sess, _ := newTestSession(srv, &recordingConn{})
+	sess.Player.Name = "Ranger"
+	srv.Sessions[sess.Id] = sess
+	for _, cmd := range []string{"prespawn", "spawn", "begin"} {
+		srv.ExecClient(sess, []string{cmd})
+	}
+	sess.Message.Reset()
+
+	srv.ExecClient(sess, []string{"kill"})
+	if got, want := sess.Message.String(), "\x08Ranger suicides\n\x00"; got != want {
+		t.Errorf("message = %q, want = %q", got, want)
+	}
+	srv.Frame(time.Unix(100, 0))
+	if got, want := sess.Player.Frags, -2; got != want {
+		t.Errorf("frags = %d, want = %d", got, want)
+	}
+	if got, want := srv.clientEdict(sess).V.Health, Float(100); got != want {
+		t.Errorf("health = %v, want = %v", got, want)
+	}
+
+	srv.clientEdict(sess).V.Health = 0
+	sess.Message.Reset()
+	srv.ExecClient(sess, []string{"kill"})
+	if got, want := sess.Message.String(), "\x08Can't suicide -- allready dead!\n\x00"; got != want {
+		t.Errorf("message = %q, want = %q", got, want)
+	}
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/matttproud/go-quake/cvar"
+	"github.com/matttproud/go-quake/proto/protonetquake"
+
+	. "github.com/matttproud/go-quake/qtype"
+)
+
+// The rules follow CheckRules and NextLevel of the QuakeC game: once a
+// deathmatch reaches its fraglimit or timelimit, the game enters intermission
+// and, after it has been shown for a while and a player presses a button,
+// moves on to the next level.
+
+const (
+	intermissionDeathmatch = 5 * time.Second
+	intermissionCoop       = 2 * time.Second
+)
+
+type levelVars struct {
+	cvFragLimit *cvar.Float
+	cvTimeLimit *cvar.Float
+	cvSameLevel *cvar.Float
+	cvNoExit    *cvar.Float
+}
+
+type intermission struct {
+	running  bool
+	exitTime time.Duration // server time at which it may end
+	nextMap  string
+}
+
+// limitReached reports whether the game has reached its timelimit, which is
+// in minutes, or its fraglimit.  Match mode decides for itself when a game
+// ends.
+func (s *Server) limitReached() bool {
+	if s.cvDeathmatch.Get() == 0 || s.cvMatchMode.Get() != 0 {
+		return false
+	}
+	if limit := s.cvTimeLimit.Get(); limit > 0 && s.Time.Minutes() >= float64(limit) {
+		return true
+	}
+	limit := s.cvFragLimit.Get()
+	if limit <= 0 {
+		return false
+	}
+	for _, sess := range s.Sessions {
+		if sess.Spawned && float32(sess.Player.Frags) >= limit {
+			return true
+		}
+	}
+	return false
+}
+
+// nextLevel chooses the map to follow the current one: the same map under
+// samelevel, else the next in the rotation if there is one, else the map to
+// which the level exits unless noexit disables the exits.
+func (s *Server) nextLevel() string {
+	if s.cvSameLevel.Get() != 0 {
+		return s.Map
+	}
+	if next := s.nextInRotation(); next != "" {
+		return next
+	}
+	if s.cvNoExit.Get() != 0 || s.NextMap == "" {
+		return s.Map
+	}
+	return s.NextMap
+}
+
+// StartIntermission freezes the players and shows them the scoreboard before
+// the game moves on to nextMap.
+func (s *Server) StartIntermission(nextMap string) {
+	if s.intermission.running {
+		return
+	}
+	d := intermissionCoop
+	if s.cvDeathmatch.Get() != 0 {
+		d = intermissionDeathmatch
+	}
+	s.intermission = intermission{running: true, exitTime: s.Time + d, nextMap: nextMap}
+	for _, sess := range s.Sessions {
+		if e := s.clientEdict(sess); e != nil {
+			e.V.ViewOfs = Vec3{}
+			e.V.TakeDamage = 0
+			e.V.Solid = 0
+			e.V.MoveType = moveTypeNone
+			e.V.ModelIndex = 0
+		}
+	}
+	var m Message
+	m.WriteByte(protonetquake.SVCCDTrack)
+	m.WriteByte(3)
+	m.WriteByte(3)
+	m.WriteByte(protonetquake.SVCIntermission)
+	s.Reliable(m.Bytes())
+	s.log.Printf("Intermission; next map is %q", nextMap)
+}
+
+// Intermission reports whether the game is in intermission.
+func (s *Server) Intermission() bool { return s.intermission.running }
+
+// runRules checks the limits and ends the intermission once it has run its
+// course and a player asks to continue, or no one is left to ask.
+func (s *Server) runRules() {
+	if !s.intermission.running {
+		if s.limitReached() {
+			s.StartIntermission(s.nextLevel())
+		}
+		return
+	}
+	if s.Time < s.intermission.exitTime {
+		return
+	}
+	var spawned, pressed bool
+	for _, sess := range s.Sessions {
+		spawned = spawned || sess.Spawned
+		pressed = pressed || sess.Spawned && sess.Player.buttons != 0
+	}
+	if pressed || !spawned {
+		if err := s.ChangeLevel(s.intermission.nextMap); err != nil {
+			s.log.Print(err)
+			s.ChangeLevel(s.Map)
+		}
+	}
+}
+
+type errUnknownMap string
+
+func (e errUnknownMap) Error() string { return "no such map: " + string(e) }
+
+// levelExit checks that mapname is among the assets and returns the map to
+// which the first trigger_changelevel of its entities leads, if any.  Without
+// assets, there is nothing against which to check.
+func (s *Server) levelExit(mapname string) (string, error) {
+	if mapname == "" || strings.ContainsAny(mapname, `/\.`) {
+		return "", errUnknownMap(mapname)
+	}
+	if s.Assets == nil {
+		return "", nil
+	}
+	r, err := s.Assets.Load("maps/" + mapname + ".bsp")
+	if os.IsNotExist(err) {
+		return "", errUnknownMap(mapname)
+	}
+	if err != nil {
+		return "", err
+	}
+	// The entities are the first lump of the bsp.
+	var hdr struct{ Version, EntitiesOffset, EntitiesLength int32 }
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return "", fmt.Errorf("map %s: %v", mapname, err)
+	}
+	if hdr.EntitiesOffset < 0 || hdr.EntitiesLength < 0 || int64(hdr.EntitiesOffset)+int64(hdr.EntitiesLength) > r.Size() {
+		return "", fmt.Errorf("map %s: entities lie outside the file", mapname)
+	}
+	ents := make([]byte, hdr.EntitiesLength)
+	if _, err := r.ReadAt(ents, int64(hdr.EntitiesOffset)); err != nil {
+		return "", fmt.Errorf("map %s: %v", mapname, err)
+	}
+	for _, ent := range strings.Split(string(ents), "}") {
+		// The quoted keys and values fall at the odd indices.
+		fields := strings.Split(ent, `"`)
+		var class, next string
+		for i := 1; i+2 < len(fields); i += 4 {
+			switch fields[i] {
+			case "classname":
+				class = fields[i+2]
+			case "map":
+				next = fields[i+2]
+			}
+		}
+		if class == "trigger_changelevel" && next != "" {
+			return next, nil
+		}
+	}
+	return "", nil
+}
+
+// ChangeLevel moves the game to mapname and sends the connected clients
+// through signon again, as SV_SpawnServer does.  The map must exist unless
+// it is the current one.
+func (s *Server) ChangeLevel(mapname string) error {
+	next := s.NextMap
+	if mapname != s.Map {
+		var err error
+		if next, err = s.levelExit(mapname); err != nil {
+			return err
+		}
+	}
+	s.log.Printf("Changing level to %q", mapname)
+	s.saveStats()
+	s.Map = mapname
+	s.NextMap = next
+	s.Time = 0
+	s.Paused = false
+	s.intermission = intermission{}
+	s.vote = nil
+	s.allocEdicts()
+	var m Message
+	m.WriteByte(protonetquake.SVCStuffText)
+	m.WriteCString("reconnect\n")
+	for _, sess := range s.Sessions {
+		if err := sess.SendUnreliable(m.Bytes()); err != nil {
+			s.log.Printf("Reconnecting %v: %v", sess.Id, err)
+		}
+		sess.Player.Frags = 0
+		sess.Player.buttons = 0
+		sess.Player.nextShot = 0
+		sess.SendServerInfo(s)
+	}
+	return nil
+}
+
+func (s *Server) cmdChangeLevel(args ...string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: changelevel <levelname>")
+	}
+	return s.ChangeLevel(args[0])
+}
+
+func (s *Server) cmdRestart(args ...string) error {
+	return s.ChangeLevel(s.Map)
+}
+
+func (s *Server) initIntermission() {
+	s.addCommand("changelevel", s.cmdChangeLevel)
+	s.addCommand("restart", s.cmdRestart)
+}
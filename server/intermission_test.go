@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matttproud/go-quake/path"
+	"github.com/matttproud/go-quake/proto/protonetquake"
+)
+
+func TestIntermission(t *testing.T) {
+	for _, test := range []struct {
+		sameLevel float32
+		want      string
+	}{
+		{0, "e1m2"},
+		{1, "e1m1"},
+	} {
+		srv := newTestServer(t)
+		srv.Map = "e1m1"
+		srv.NextMap = "e1m2"
+		srv.cvDeathmatch.Set(1)
+		srv.cvFragLimit.Set(10)
+		srv.cvSameLevel.Set(test.sameLevel)
+		sess, _ := newTestSession(srv, &recordingConn{})
+		sess.Spawned = true
+		sess.PassedAuth = true
+		srv.Sessions[sess.Id] = sess
+
+		start := time.Unix(100, 0)
+		srv.Frame(start)
+		sess.Player.Frags = 9
+		srv.Frame(start.Add(time.Second))
+		if srv.Intermission() {
+			t.Fatal("intermission before the fraglimit")
+		}
+		sess.Player.Frags = 10
+		sess.Message.Reset()
+		srv.Frame(start.Add(2 * time.Second))
+		if !srv.Intermission() {
+			t.Fatal("no intermission at the fraglimit")
+		}
+		if !bytes.Contains(sess.Message.Bytes(), []byte{protonetquake.SVCIntermission}) {
+			t.Errorf("message = %q, want svc_intermission", sess.Message.Bytes())
+		}
+
+		sess.Player.buttons = 1
+		srv.Frame(start.Add(4 * time.Second))
+		if !srv.Intermission() {
+			t.Fatal("intermission ended early")
+		}
+		srv.Frame(start.Add(8 * time.Second))
+		if srv.Intermission() {
+			t.Fatal("intermission did not end")
+		}
+		if got := srv.Map; got != test.want {
+			t.Errorf("samelevel %v: map = %q, want = %q", test.sameLevel, got, test.want)
+		}
+		if sess.Spawned || sess.Player.Frags != 0 {
+			t.Error("client was not sent through signon again")
+		}
+	}
+}
+
+// writeMap writes a bsp that holds only the given entities.
+func writeMap(t *testing.T, dir, name, entities string) {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, []int32{29, 12, int32(len(entities))})
+	b.WriteString(entities)
+	if err := os.WriteFile(filepath.Join(dir, "maps", name+".bsp"), b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChangeLevel(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "maps"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeMap(t, dir, "e1m1", `{
+"classname" "worldspawn"
+}
+{
+"classname" "trigger_changelevel"
+"map" "e1m2"
+}
+`)
+	writeMap(t, dir, "dm1", `{ "classname" "worldspawn" }`)
+	assets, err := path.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer assets.Close()
+	srv := newTestServer(t)
+	srv.Assets = assets
+
+	for _, test := range []struct {
+		mapname     string
+		err         bool
+		level, next string
+	}{
+		{"e1m1", false, "e1m1", "e1m2"},
+		{"e1m9", true, "e1m1", "e1m2"},
+		{"../e1m1", true, "e1m1", "e1m2"},
+		{"dm1", false, "dm1", ""},
+	} {
+		err := srv.Exec("changelevel " + test.mapname)
+		if got := err != nil; got != test.err {
+			t.Errorf("changelevel %s: err = %v, want error %v", test.mapname, err, test.err)
+		}
+		if srv.Map != test.level || srv.NextMap != test.next {
+			t.Errorf("changelevel %s: map, next = %q, %q, want = %q, %q", test.mapname, srv.Map, srv.NextMap, test.level, test.next)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+package server
+
+func (s *Server) initKeys() {
+	s.addCommand("bind", noImpl)
+	s.addCommand("unbind", noImpl)
+	s.addCommand("unbindall", noImpl)
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/matttproud/go-quake/cvar"
+)
+
+const mapListFile = "maplist.txt"
+
+type mapListVars struct {
+	cvMapList *cvar.String
+}
+
+// LoadMapList reads the map rotation from path, which holds one map name per
+// line and needn't exist.
+func LoadMapList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var maps []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		maps = append(maps, line)
+	}
+	return maps, scanner.Err()
+}
+
+// rotation is the cycle of maps, which sv_maplist overrides.
+func (s *Server) rotation() []string {
+	if l := strings.Fields(s.cvMapList.Get()); len(l) > 0 {
+		return l
+	}
+	return s.MapList
+}
+
+// nextInRotation returns the map that follows the current one in the
+// rotation, or the first if the current map is not part of it.
+func (s *Server) nextInRotation() string {
+	maps := s.rotation()
+	if len(maps) == 0 {
+		return ""
+	}
+	for i, m := range maps {
+		if m == s.Map {
+			return maps[(i+1)%len(maps)]
+		}
+	}
+	return maps[0]
+}
+
+func (s *Server) cmdMapList(args ...string) error {
+	for _, m := range s.rotation() {
+		if m == s.Map {
+			s.conPrintf("* %s\n", m)
+		} else {
+			s.conPrintf("  %s\n", m)
+		}
+	}
+	return nil
+}
+
+func (s *Server) initMapList() {
+	s.addCommand("maplist", s.cmdMapList)
+
+	s.cvMapList = s.newString("sv_maplist", "")
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/matttproud/go-quake/command"
+	"github.com/matttproud/go-quake/cvar"
+
+	. "github.com/matttproud/go-quake/qtype"
+)
+
+// Match mode runs organized games without help from the game VM.  Players
+// warm up, respawning at once and for free, until all of them are ready,
+// upon which a countdown begins.  When
+// it ends the level restarts, clearing the frags, and the match runs for
+// sv_matchtime minutes, extended by sv_matchovertime minutes for as long as
+// the lead is tied.  A summary is printed when the match ends.
+
+type matchVars struct {
+	cvMatchMode       *cvar.Float
+	cvMatchTime       *cvar.Float
+	cvMatchOvertime   *cvar.Float
+	cvMatchCountdown  *cvar.Float
+	cvMatchMinPlayers *cvar.Float
+}
+
+type matchState int
+
+const (
+	matchWarmup matchState = iota
+	matchCountdown
+	matchLive
+	matchOvertime
+)
+
+func (m matchState) String() string {
+	switch m {
+	case matchWarmup:
+		return "warmup"
+	case matchCountdown:
+		return "countdown"
+	case matchLive:
+		return "live"
+	case matchOvertime:
+		return "overtime"
+	}
+	return "invalid"
+}
+
+type match struct {
+	state     matchState
+	until     time.Duration // server time at which the countdown or period ends
+	announced int           // seconds of countdown last announced
+	ready     map[string]bool
+}
+
+func (m *match) setReady(sess *Session, ready bool) {
+	if m.ready == nil {
+		m.ready = make(map[string]bool)
+	}
+	m.ready[sess.Id] = ready
+}
+
+// allReady reports whether enough players are in the game and all are ready.
+func (s *Server) allReady() bool {
+	var n int
+	for _, sess := range s.Sessions {
+		if !sess.Spawned {
+			continue
+		}
+		if !s.match.ready[sess.Id] {
+			return false
+		}
+		n++
+	}
+	return n > 0 && float32(n) >= s.cvMatchMinPlayers.Get()
+}
+
+// scoreName is the name under which sess scores: its team's under teamplay
+// and its own otherwise.
+func (s *Server) scoreName(sess *Session) string {
+	if s.cvTeamplay.Get() != 0 {
+		return fmt.Sprintf("team %d", sess.Player.Team)
+	}
+	return sess.Player.Name
+}
+
+type score struct {
+	name  string
+	frags int
+}
+
+// scores returns the players' or, under teamplay, the teams' frags from
+// highest to lowest.
+func (s *Server) scores() []score {
+	var out []score
+	if s.cvTeamplay.Get() != 0 {
+		teams := make(map[string]int)
+		for _, sess := range s.Sessions {
+			teams[s.scoreName(sess)] += sess.Player.Frags
+		}
+		for team, frags := range teams {
+			out = append(out, score{team, frags})
+		}
+	} else {
+		for _, sess := range s.Sessions {
+			out = append(out, score{sess.Player.Name, sess.Player.Frags})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].frags != out[j].frags {
+			return out[i].frags > out[j].frags
+		}
+		return out[i].name < out[j].name
+	})
+	return out
+}
+
+func tied(scores []score) bool {
+	return len(scores) > 1 && scores[0].frags == scores[1].frags
+}
+
+// warmupRespawns makes deaths before the match free: the dead are put back
+// into the level at once and the frags that anyone gained or lost are
+// undone.  It runs ahead of syncFrags, which then sees no change.
+func (s *Server) warmupRespawns() {
+	if s.cvMatchMode.Get() == 0 || s.Intermission() || s.match.state >= matchLive {
+		return
+	}
+	for _, sess := range s.Sessions.Sorted() {
+		e := s.clientEdict(sess)
+		if e == nil || !sess.Spawned {
+			continue
+		}
+		if e.V.Health <= 0 {
+			s.spawnEdict(sess)
+			continue
+		}
+		e.V.Frags = Float(sess.Player.Frags)
+	}
+}
+
+// runMatch advances the match by one host frame.
+func (s *Server) runMatch() {
+	if s.cvMatchMode.Get() == 0 || s.Intermission() {
+		return
+	}
+	m := &s.match
+	switch m.state {
+	case matchWarmup:
+		if s.allReady() {
+			m.state, m.until, m.announced = matchCountdown, s.Time+seconds(s.cvMatchCountdown.Get()), 0
+		}
+	case matchCountdown:
+		if !s.allReady() {
+			m.state = matchWarmup
+			s.CenterPrintf("Countdown aborted")
+			return
+		}
+		left := m.until - s.Time
+		if left <= 0 {
+			s.startMatch()
+			return
+		}
+		if secs := int((left + time.Second - 1) / time.Second); secs != m.announced {
+			m.announced = secs
+			s.CenterPrintf("Match begins in %d", secs)
+		}
+	case matchLive, matchOvertime:
+		if s.Time < m.until {
+			return
+		}
+		if tied(s.scores()) {
+			m.state, m.until = matchOvertime, s.Time+seconds(s.cvMatchOvertime.Get()*60)
+			s.CenterPrintf("Overtime!")
+			s.BroadcastPrintf("The lead is tied; %g minutes of overtime\n", s.cvMatchOvertime.Get())
+			return
+		}
+		s.endMatch()
+	}
+}
+
+func (s *Server) startMatch() {
+	s.ChangeLevel(s.Map)
+	s.match.state, s.match.until = matchLive, seconds(s.cvMatchTime.Get()*60)
+	s.BroadcastPrintf("The match has begun!\n")
+	s.log.Printf("Match started on %s", s.Map)
+}
+
+// endMatch prints the summary and shows the scoreboard before returning to
+// warmup.
+func (s *Server) endMatch() {
+	scores := s.scores()
+	text := fmt.Sprintf("Match over after %v on %s\n", s.Time.Truncate(time.Second), s.Map)
+	for i, sc := range scores {
+		text += fmt.Sprintf("%2d. %-16s %3d\n", i+1, sc.name, sc.frags)
+	}
+	s.BroadcastPrintf("%s", text)
+	if len(scores) > 0 && !tied(scores) {
+		s.CenterPrintf("%s wins!", scores[0].name)
+		for _, sess := range s.Sessions {
+			if s.scoreName(sess) == scores[0].name {
+				s.logEvent("win", sess, nil, "")
+			}
+		}
+	}
+	s.log.Print(text)
+	s.match = match{}
+	s.StartIntermission(s.nextLevel())
+}
+
+func cmdReady(s *Session, args ...string) error {
+	s.srv.match.setReady(s, true)
+	s.srv.BroadcastPrintf("%s is ready\n", s.Player.Name)
+	return nil
+}
+
+func cmdNotReady(s *Session, args ...string) error {
+	s.srv.match.setReady(s, false)
+	s.srv.BroadcastPrintf("%s is not ready\n", s.Player.Name)
+	return nil
+}
+
+func (s *Server) cmdMatch(args ...string) error {
+	if len(args) == 0 {
+		s.conPrintf("match %v\n", s.match.state)
+		for _, sess := range s.Sessions.Sorted() {
+			s.conPrintf("%-16s ready: %v\n", sess.Player.Name, s.match.ready[sess.Id])
+		}
+		return nil
+	}
+	switch args[0] {
+	case "abort":
+		s.match = match{}
+		s.BroadcastPrintf("The match was aborted\n")
+	case "start":
+		s.startMatch()
+	default:
+		return fmt.Errorf("usage: match [start | abort]")
+	}
+	return nil
+}
+
+func (s *Server) initMatch() {
+	s.addCommand("ready", s.clientCmd("ready", cmdReady), command.ClientCallable)
+	s.addCommand("notready", s.clientCmd("notready", cmdNotReady), command.ClientCallable)
+	s.addCommand("match", s.cmdMatch)
+
+	s.cvMatchMode = s.newFloat("sv_matchmode", 0, cvar.ServerSide)
+	s.cvMatchTime = s.newFloat("sv_matchtime", 20, cvar.ServerSide)
+	s.cvMatchOvertime = s.newFloat("sv_matchovertime", 5, cvar.ServerSide)
+	s.cvMatchCountdown = s.newFloat("sv_matchcountdown", 10)
+	s.cvMatchMinPlayers = s.newFloat("sv_matchminplayers", 2)
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/matttproud/go-quake/qtype"
+)
+
+func TestMatch(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Map = "dm6"
+	srv.cvMatchMode.Set(1)
+	var players []*Session
+	for _, name := range []string{"alice", "bob"} {
+		sess, _ := newTestSession(srv, &recordingConn{})
+		sess.Id = name
+		sess.Player.Name = name
+		sess.Spawned = true
+		sess.PassedAuth = true
+		srv.Sessions[name] = sess
+		players = append(players, sess)
+	}
+	now := time.Unix(100, 0)
+	frame := func(d time.Duration) {
+		now = now.Add(d)
+		srv.Frame(now)
+	}
+	expect := func(want matchState) {
+		t.Helper()
+		if got := srv.match.state; got != want {
+			t.Fatalf("state = %v, want = %v", got, want)
+		}
+	}
+
+	frame(0)
+	srv.ExecClient(players[0], []string{"ready"})
+	frame(time.Second)
+	expect(matchWarmup)
+	srv.ExecClient(players[1], []string{"ready"})
+	frame(time.Second)
+	expect(matchCountdown)
+
+	players[0].Player.Frags = 3
+	frame(5 * time.Second)
+	expect(matchCountdown)
+	frame(5 * time.Second)
+	expect(matchLive)
+	if players[0].Player.Frags != 0 || srv.Time != 0 {
+		t.Fatal("match did not restart the level")
+	}
+
+	players[0].Player.Frags, players[1].Player.Frags = 10, 10
+	frame(20 * time.Minute)
+	expect(matchOvertime)
+	players[1].Player.Frags = 11
+	frame(5 * time.Minute)
+	expect(matchWarmup)
+	if !srv.Intermission() {
+		t.Error("no intermission after the match")
+	}
+	if got, want := srv.scores()[0], (score{"bob", 11}); got != want {
+		t.Errorf("winner = %v, want = %v", got, want)
+	}
+}
+
+func TestWarmupRespawns(t *testing.T) {
+	srv := newTestServer(t)
+	srv.cvMatchMode.Set(1)
+	sess, _ := newTestSession(srv, &recordingConn{})
+	sess.Player.Name = "alice"
+	srv.Sessions[sess.Id] = sess
+	for _, cmd := range []string{"prespawn", "spawn", "begin"} {
+		srv.ExecClient(sess, []string{cmd})
+	}
+	now := time.Unix(100, 0)
+
+	srv.ExecClient(sess, []string{"kill"})
+	srv.Frame(now)
+	if got := sess.Player.Frags; got != 0 {
+		t.Errorf("frags after a warmup kill = %d, want = 0", got)
+	}
+	srv.clientEdict(sess).V.Health = -10
+	srv.Frame(now.Add(time.Second))
+	if got, want := srv.clientEdict(sess).V.Health, Float(100); got != want {
+		t.Errorf("health after dying in warmup = %v, want = %v", got, want)
+	}
+
+	srv.match.state = matchLive
+	srv.ExecClient(sess, []string{"kill"})
+	srv.Frame(now.Add(2 * time.Second))
+	if got, want := sess.Player.Frags, -2; got != want {
+		t.Errorf("frags after a live kill = %d, want = %d", got, want)
+	}
+}
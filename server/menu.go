@@ -0,0 +1,16 @@
+package server
+
+func (s *Server) initMenu() {
+	s.addCommand("togglemenu", noImpl)
+	s.addCommand("menu_main", noImpl)
+	s.addCommand("menu_singleplayer", noImpl)
+	s.addCommand("menu_load", noImpl)
+	s.addCommand("menu_save", noImpl)
+	s.addCommand("menu_multiplayer", noImpl)
+	s.addCommand("menu_setup", noImpl)
+	s.addCommand("menu_options", noImpl)
+	s.addCommand("menu_keys", noImpl)
+	s.addCommand("menu_video", noImpl)
+	s.addCommand("help", noImpl)
+	s.addCommand("menu_quit", noImpl)
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// Message accumulates server commands in the wire encoding of MSG_Write*.
+type Message struct {
+	bytes.Buffer
+}
+
+func (m *Message) WriteChar(c int8) { m.WriteByte(byte(c)) }
+
+func (m *Message) WriteShort(v int16) {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], uint16(v))
+	m.Write(b[:])
+}
+
+func (m *Message) WriteLong(v int32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(v))
+	m.Write(b[:])
+}
+
+func (m *Message) WriteFloat(v float32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], math.Float32bits(v))
+	m.Write(b[:])
+}
+
+// WriteCString writes s followed by its NUL terminator.
+func (m *Message) WriteCString(s string) {
+	m.WriteString(s)
+	m.WriteByte(0)
+}
+
+func (m *Message) WriteCoord(v float32) { m.WriteShort(int16(v * 8)) }
+
+func (m *Message) WriteAngle(v float32) { m.WriteByte(byte(int(v*256/360) & 255)) }
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Metrics are exported at /metrics on the inspection server in the Prometheus
+// text exposition format.
+
+type counter struct {
+	n uint64
+}
+
+func (c *counter) Inc()         { atomic.AddUint64(&c.n, 1) }
+func (c *counter) Add(n uint64) { atomic.AddUint64(&c.n, n) }
+func (c *counter) Get() uint64  { return atomic.LoadUint64(&c.n) }
+
+// counterVec is a family of counters partitioned by the value of one label.
+type counterVec struct {
+	label string
+	vals  map[string]*counter
+	mtx   sync.Mutex
+}
+
+func newCounterVec(label string) *counterVec {
+	return &counterVec{label: label, vals: make(map[string]*counter)}
+}
+
+func (v *counterVec) With(val string) *counter {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	c, ok := v.vals[val]
+	if !ok {
+		c = new(counter)
+		v.vals[val] = c
+	}
+	return c
+}
+
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	n      uint64
+	mtx    sync.Mutex
+}
+
+func newHistogram(bounds ...float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) Observe(v float64) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if i := sort.SearchFloat64s(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.n++
+}
+
+// metrics are kept by each server.
+type metrics struct {
+	frameSeconds    *histogram
+	reliableResends *counter
+	datagramsDrop   *counterVec
+	connects        *counterVec
+	ctrlDropped     *counterVec
+}
+
+func newMetrics() metrics {
+	return metrics{
+		frameSeconds:    newHistogram(.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1),
+		reliableResends: new(counter),
+		datagramsDrop:   newCounterVec("reason"),
+		connects:        newCounterVec("result"),
+		ctrlDropped:     newCounterVec("reason"),
+	}
+}
+
+type expositionWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (e *expositionWriter) printf(format string, args ...interface{}) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = fmt.Fprintf(e.w, format, args...)
+}
+
+func (e *expositionWriter) header(name, typ, help string) {
+	e.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// labelEscaper escapes a label value as the text format requires, which is
+// less than Go quoting does.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func (e *expositionWriter) counter(name, help string, c *counter) {
+	e.header(name, "counter", help)
+	e.printf("%s %d\n", name, c.Get())
+}
+
+func (e *expositionWriter) gauge(name, help string, v float64) {
+	e.header(name, "gauge", help)
+	e.printf("%s %s\n", name, formatFloat(v))
+}
+
+func (e *expositionWriter) counterVec(name, help string, v *counterVec) {
+	e.header(name, "counter", help)
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	vals := make([]string, 0, len(v.vals))
+	for val := range v.vals {
+		vals = append(vals, val)
+	}
+	sort.Strings(vals)
+	for _, val := range vals {
+		e.printf("%s{%s=\"%s\"} %d\n", name, v.label, labelEscaper.Replace(val), v.vals[val].Get())
+	}
+}
+
+func (e *expositionWriter) histogram(name, help string, h *histogram) {
+	e.header(name, "histogram", help)
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	var cum uint64
+	for i, b := range h.bounds {
+		cum += h.counts[i]
+		e.printf("%s_bucket{le=\"%s\"} %d\n", name, formatFloat(b), cum)
+	}
+	e.printf("%s_bucket{le=\"+Inf\"} %d\n", name, h.n)
+	e.printf("%s_sum %s\n", name, formatFloat(h.sum))
+	e.printf("%s_count %d\n", name, h.n)
+}
+
+type sessionMetrics struct {
+	id         string
+	packetsIn  uint64
+	packetsOut uint64
+}
+
+func (m *metrics) write(w io.Writer, edicts int, sessions []sessionMetrics) error {
+	e := &expositionWriter{w: bufio.NewWriter(w)}
+	e.histogram("quake_host_frame_seconds", "Duration of host frames.", m.frameSeconds)
+	e.gauge("quake_edicts_in_use", "Edicts currently allocated.", float64(edicts))
+	e.header("quake_session_packets_total", "counter", "Datagrams exchanged with each session.")
+	for _, s := range sessions {
+		e.printf("quake_session_packets_total{session=\"%s\",direction=\"in\"} %d\n", labelEscaper.Replace(s.id), s.packetsIn)
+		e.printf("quake_session_packets_total{session=\"%s\",direction=\"out\"} %d\n", labelEscaper.Replace(s.id), s.packetsOut)
+	}
+	e.counter("quake_reliable_resends_total", "Reliable messages retransmitted.", m.reliableResends)
+	e.counterVec("quake_datagrams_dropped_total", "Datagrams discarded on receipt.", m.datagramsDrop)
+	e.counterVec("quake_connects_total", "Connection requests by outcome.", m.connects)
+	e.counterVec("quake_control_dropped_total", "Control packets ignored by the flood protection.", m.ctrlDropped)
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var (
+		edicts   int
+		sessions []sessionMetrics
+	)
+	if err := s.onFrame(func() {
+		edicts = s.EdictsInUse()
+		for _, sess := range s.Sessions {
+			sessions = append(sessions, sessionMetrics{
+				id:         sess.Id,
+				packetsIn:  atomic.LoadUint64(&sess.packetsIn),
+				packetsOut: atomic.LoadUint64(&sess.packetsOut),
+			})
+		}
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].id < sessions[j].id })
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.metrics.write(w, edicts, sessions)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestHistogramExposition(t *testing.T) {
+	h := newHistogram(1, 2, 4)
+	for _, v := range []float64{0.5, 1, 3, 8} {
+		h.Observe(v)
+	}
+	var buf bytes.Buffer
+	e := &expositionWriter{w: bufio.NewWriter(&buf)}
+	e.histogram("test_seconds", "Test histogram.", h)
+	if err := e.w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	const want = `# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="2"} 2
+test_seconds_bucket{le="4"} 3
+test_seconds_bucket{le="+Inf"} 4
+test_seconds_sum 12.5
+test_seconds_count 4
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got = %v, want = %v", got, want)
+	}
+}
+
+func TestCounterVecExposition(t *testing.T) {
+	v := newCounterVec("reason")
+	v.With("stale").Inc()
+	v.With("short_read").Add(3)
+	v.With("stale").Inc()
+	var buf bytes.Buffer
+	e := &expositionWriter{w: bufio.NewWriter(&buf)}
+	e.counterVec("test_total", "Test counter.", v)
+	if err := e.w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	const want = `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{reason="short_read"} 3
+test_total{reason="stale"} 2
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got = %v, want = %v", got, want)
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"stale", "stale"},
+		{`a"b`, `a\"b`},
+		{`a\b`, `a\\b`},
+		{"a\nb", `a\nb`},
+		{"café\t", "café\t"},
+	} {
+		if got := labelEscaper.Replace(tt.in); got != tt.want {
+			t.Errorf("labelEscaper.Replace(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"time"
+
+	"github.com/matttproud/go-quake/cvar"
+	"github.com/matttproud/go-quake/proto/protonetquake"
+	"github.com/matttproud/go-quake/slist"
+)
+
+// DefaultPort is that on which servers listen unless told otherwise.
+const DefaultPort = protonetquake.DefaultPort
+
+type netVars struct {
+	cvHostname          *cvar.String
+	cvNetMessageTimeout *cvar.Float
+}
+
+func isErrTransient(err error) bool {
+	if err == nil {
+		return true
+	}
+	type timeouter interface {
+		Timeout() bool
+	}
+	if tout, ok := err.(timeouter); ok {
+		if tout.Timeout() {
+			return true
+		}
+	}
+	type temporaryer interface {
+		Temporary() bool
+	}
+	if temp, ok := err.(temporaryer); ok {
+		if temp.Temporary() {
+			return true
+		}
+	}
+	return false
+}
+
+const slistTimeout = 1500 * time.Millisecond
+
+// cmdSlist lists the servers on the local network or, given arguments, the
+// named hosts.  It waits out the replies before returning so that the listing
+// reaches whichever console, rcon or API caller ran it; the host frame stalls
+// meanwhile, as the stock dedicated server's does.
+func (s *Server) cmdSlist(args ...string) error {
+	var addrs []net.Addr
+	for _, h := range args {
+		addr, err := slist.Resolve(h, s.port())
+		if err != nil {
+			return err
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		addrs = append(addrs, slist.Broadcast(s.port()))
+	}
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	s.conPrintf("Looking for Quake servers...\n")
+	servers, err := slist.Query(conn, addrs, slistTimeout)
+	if err != nil {
+		return err
+	}
+	if len(servers) == 0 {
+		s.conPrintf("No Quake servers found.\n")
+		return nil
+	}
+	var buf bytes.Buffer
+	slist.WriteTable(&buf, servers)
+	s.conPrintf("%s", buf.String())
+	return nil
+}
+
+// port is that of the control socket, on which other servers are sought
+// too.
+func (s *Server) port() int {
+	if s.Conn != nil {
+		if port, err := addrPort(s.Conn.LocalAddr()); err == nil {
+			return port
+		}
+	}
+	return DefaultPort
+}
+
+func (s *Server) initNet() {
+	s.addCommand("slist", s.cmdSlist)
+	s.addCommand("listen", noImpl)
+	s.addCommand("maxplayers", s.cmdMaxPlayers)
+	s.addCommand("port", noImpl)
+	s.addCommand("net_stats", noImpl)
+	s.addCommand("test", noImpl)
+	s.addCommand("test2", noImpl)
+
+	s.cvNetMessageTimeout = s.newFloat("net_messagetimeout", 300)
+	s.cvHostname = s.newString("hostname", "UNNAMED")
+	// omitted many modem and IPX settings
+
+	hn, err := os.Hostname()
+	if err == nil {
+		s.cvHostname.Set(hn)
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+)
+
+func TestSlistOutputReachesCaller(t *testing.T) {
+	peer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	go func() {
+		var buf [protonetquake.MaxDatagram]byte
+		_, from, err := peer.ReadFrom(buf[:])
+		if err != nil {
+			return
+		}
+		reply := append([]byte("10.0.0.1:26000\x00peer\x00e1m1\x00"), 2, 8, protonetquake.NetProtocolVersion)
+		peer.WriteTo(protonetquake.CtrlPacket(protonetquake.CCRepServerInfo, reply), from)
+	}()
+
+	srv := newTestServer(t)
+	var out bytes.Buffer
+	restore := srv.con.redirect(&out)
+	err = srv.Exec("slist " + peer.LocalAddr().String())
+	restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, "peer") || !strings.Contains(got, "e1m1") {
+		t.Errorf("got = %q, want a listing of peer on e1m1", got)
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+)
+
+// The datagram channel mirrors net_dgrm.c: reliable messages are split into
+// datagrams that are each acknowledged before the next is sent, while
+// unreliable datagrams carry their own sequence so that stale ones may be
+// discarded.
+
+const (
+	maxMessage        = 8192
+	resendInterval    = time.Second
+	keepaliveInterval = 5 * time.Second
+	maxDatagramData   = protonetquake.MaxDatagram - protonetquake.NetHeaderSize
+)
+
+type netchan struct {
+	sendSeq       int
+	unreliableSeq int
+	recvSeq       int
+	sending       []byte // remainder of the reliable message being sent
+	lastSend      time.Time
+	lastNop       time.Time
+	received      []byte // reliable message being reassembled
+}
+
+func encodeDatagram(flags uint32, seq int, data []byte) []byte {
+	out := make([]byte, protonetquake.NetHeaderSize+len(data))
+	binary.BigEndian.PutUint32(out[0:4], flags|uint32(len(out)))
+	binary.BigEndian.PutUint32(out[4:8], uint32(seq))
+	copy(out[protonetquake.NetHeaderSize:], data)
+	return out
+}
+
+func (s *Session) writeDatagram(flags uint32, seq int, data []byte) error {
+	msg := encodeDatagram(flags, seq, data)
+	n, err := s.Conn.WriteTo(msg, s.RemoteAddr)
+	if err != nil {
+		return err
+	}
+	if n != len(msg) {
+		return newErrShortWrite(n, len(msg))
+	}
+	atomic.AddUint64(&s.packetsOut, 1)
+	return nil
+}
+
+// CanSendMessage reports whether no reliable message is in flight.
+func (s *Session) CanSendMessage() bool { return s.channel.sending == nil }
+
+// sendChunk transmits the next datagram of the reliable message in flight.
+func (s *Session) sendChunk(now time.Time) error {
+	data, flags := s.channel.sending, protonetquake.NetflagData|protonetquake.NetflagEOM
+	if len(data) > maxDatagramData {
+		data, flags = data[:maxDatagramData], protonetquake.NetflagData
+	}
+	s.channel.lastSend = now
+	return s.writeDatagram(flags, s.channel.sendSeq, data)
+}
+
+// SendUnreliable transmits msg immediately without guarantee of delivery.
+func (s *Session) SendUnreliable(msg []byte) error {
+	seq := s.channel.unreliableSeq
+	s.channel.unreliableSeq++
+	return s.writeDatagram(protonetquake.NetflagUnreliable, seq, msg)
+}
+
+// sendFrame begins delivery of the buffered reliable message once the
+// previous one has been acknowledged and retransmits unacknowledged ones.
+func (s *Session) sendFrame(now time.Time) error {
+	if !s.CanSendMessage() {
+		if now.Sub(s.channel.lastSend) < resendInterval {
+			return nil
+		}
+		s.srv.metrics.reliableResends.Inc()
+		return s.sendChunk(now)
+	}
+	if s.Message.Len() == 0 {
+		return nil
+	}
+	if s.Message.Len() > maxMessage {
+		return errOverflow(s.Id)
+	}
+	s.channel.sending = append([]byte(nil), s.Message.Bytes()...)
+	s.Message.Reset()
+	return s.sendChunk(now)
+}
+
+// keepalive sends a nop to a client that has heard nothing for a while, as
+// SV_SendNop does, so that it does not time out while the game is paused.
+func (s *Session) keepalive(now time.Time) error {
+	if now.Sub(s.channel.lastSend) < keepaliveInterval || now.Sub(s.channel.lastNop) < keepaliveInterval {
+		return nil
+	}
+	s.channel.lastNop = now
+	return s.SendUnreliable([]byte{protonetquake.SVCNop})
+}
+
+type errOverflow string
+
+func (e errOverflow) Error() string { return "reliable message overflow: " + string(e) }
+
+func (s *Session) handleAck(pb *datagram) error {
+	if s.CanSendMessage() || pb.Seq() != s.channel.sendSeq {
+		// Stale or duplicated acknowledgement.
+		return nil
+	}
+	s.channel.sendSeq++
+	if len(s.channel.sending) > maxDatagramData {
+		s.channel.sending = s.channel.sending[maxDatagramData:]
+		return s.sendChunk(s.srv.clock.Now())
+	}
+	s.channel.sending = nil
+	return nil
+}
+
+// handleReliable acknowledges pb and, once it completes a message, executes
+// the message.
+func (s *Session) handleReliable(pb *datagram) error {
+	if err := s.writeDatagram(protonetquake.NetflagAck, pb.Seq(), nil); err != nil {
+		return err
+	}
+	if !pb.At(s.channel.recvSeq) {
+		s.srv.metrics.datagramsDrop.With("duplicate").Inc()
+		return nil
+	}
+	s.channel.recvSeq++
+	s.channel.received = append(s.channel.received, pb.Data()...)
+	if pb.flags&protonetquake.NetflagEOM == 0 {
+		return nil
+	}
+	msg := s.channel.received
+	s.channel.received = nil
+	return s.execMsg(msg)
+}
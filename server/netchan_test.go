@@ -0,0 +1,98 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+)
+
+func newTestSession(srv *Server, conn net.PacketConn) (*Session, *bool) {
+	removed := new(bool)
+	return &Session{
+		Id:         "test-session",
+		Conn:       conn,
+		RemoteAddr: &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 26000},
+		Remove:     func() { *removed = true },
+		srv:        srv,
+	}, removed
+}
+
+func TestReliableReceive(t *testing.T) {
+	srv := newTestServer(t)
+	srv.cvPassword.Set("secret")
+	conn := &recordingConn{}
+	sess, removed := newTestSession(srv, conn)
+	msg := append([]byte{4}, "pass secret\x00"...)
+	for _, pb := range []*datagram{
+		{seq: 0, flags: protonetquake.NetflagData, data: msg[:3]},
+		{seq: 0, flags: protonetquake.NetflagData, data: msg[:3]},
+		{seq: 1, flags: protonetquake.NetflagData | protonetquake.NetflagEOM, data: msg[3:]},
+	} {
+		if err := sess.handleDatagram(pb); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, seq := range []byte{0, 0, 1} {
+		want := []byte{0, 2, 0, 8, 0, 0, 0, seq}
+		if got := conn.writes[i]; !bytes.Equal(got, want) {
+			t.Errorf("ack %d: got = %v, want = %v", i, got, want)
+		}
+	}
+	if !sess.PassedAuth {
+		t.Error("password was not accepted")
+	}
+	if *removed {
+		t.Error("session was removed")
+	}
+
+	sess.PassedAuth = false
+	sess.handleDatagram(&datagram{seq: 2, flags: protonetquake.NetflagData | protonetquake.NetflagEOM, data: append([]byte{4}, "pass wrong\x00"...)})
+	if !*removed {
+		t.Error("session with the wrong password was not removed")
+	}
+}
+
+func TestReliableSend(t *testing.T) {
+	srv := newTestServer(t)
+	conn := &recordingConn{}
+	sess, _ := newTestSession(srv, conn)
+	start := time.Unix(0, 0)
+	sess.Message.Write(bytes.Repeat([]byte{1}, maxDatagramData+10))
+	if err := sess.sendFrame(start); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(conn.writes), 1; got != want {
+		t.Fatalf("got = %v, want = %v", got, want)
+	}
+	if got, want := conn.writes[0][:8], []byte{0, 1, 4, 0, 0, 0, 0, 0}; !bytes.Equal(got, want) {
+		t.Errorf("got = %v, want = %v", got, want)
+	}
+	sess.Message.WriteByte(2)
+	sess.sendFrame(start.Add(resendInterval / 2))
+	if got, want := len(conn.writes), 1; got != want {
+		t.Fatalf("got = %v, want = %v", got, want)
+	}
+	resends := srv.metrics.reliableResends.Get()
+	sess.sendFrame(start.Add(resendInterval))
+	if got, want := len(conn.writes), 2; got != want {
+		t.Fatalf("got = %v, want = %v", got, want)
+	}
+	if got, want := srv.metrics.reliableResends.Get(), resends+1; got != want {
+		t.Errorf("got = %v, want = %v", got, want)
+	}
+	sess.handleDatagram(&datagram{seq: 0, flags: protonetquake.NetflagAck})
+	if got, want := conn.writes[2][:8], []byte{0, 9, 0, 18, 0, 0, 0, 1}; !bytes.Equal(got, want) {
+		t.Errorf("got = %v, want = %v", got, want)
+	}
+	sess.handleDatagram(&datagram{seq: 1, flags: protonetquake.NetflagAck})
+	if !sess.CanSendMessage() {
+		t.Fatal("message was not delivered")
+	}
+	sess.sendFrame(start.Add(2 * resendInterval))
+	if got, want := conn.writes[3], []byte{0, 9, 0, 9, 0, 0, 0, 2, 2}; !bytes.Equal(got, want) {
+		t.Errorf("got = %v, want = %v", got, want)
+	}
+}
@@ -0,0 +1,16 @@
+package server
+
+import "github.com/matttproud/go-quake/cvar"
+
+func (s *Server) initPhys() {
+	s.newFloat("sv_friction", 4, cvar.ServerSide)
+	s.newFloat("sv_stopspeed", 100)
+	s.newFloat("sv_gravity", 800, cvar.ServerSide)
+	s.newFloat("sv_maxvelocity", 2000)
+	s.newFloat("sv_nostep", 0)
+	s.newFloat("edgefriction", 2)
+	s.newFloat("sv_maxspeed", 320, cvar.ServerSide)
+	s.newFloat("sv_accelerate", 10)
+	s.newFloat("sv_idealpitchscale", 0.8)
+	s.newFloat("sv_aim", 0.93)
+}
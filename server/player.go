@@ -0,0 +1,200 @@
+package server
+
+import (
+	"time"
+
+	"github.com/matttproud/go-quake/prog"
+
+	. "github.com/matttproud/go-quake/qtype"
+)
+
+const maxEntLeafs = 16
+
+type EntityState struct {
+	Origin     Vec3
+	Angles     Vec3
+	ModelIndex int32
+	Frame      int32
+	ColorMap   int32
+	Skin       int32
+	Effects    int32
+}
+
+// Values of the movetype field.
+const (
+	moveTypeNone = iota
+	moveTypeAngleNoClip
+	moveTypeAngleClip
+	moveTypeWalk
+	moveTypeStep
+	moveTypeFly
+	moveTypeToss
+	moveTypePush
+	moveTypeNoClip
+	moveTypeFlyMissile
+	moveTypeBounce
+)
+
+// Values of the takedamage field.
+const (
+	damageNo = iota
+	damageYes
+	damageAim
+)
+
+// Values of the solid field.
+const (
+	solidNot = iota
+	solidTrigger
+	solidBBox
+	solidSlideBox
+	solidBSP
+)
+
+// Bits of the flags field.
+const (
+	flagFly = 1 << iota
+	flagSwim
+	_
+	flagClient
+	flagInWater
+	flagMonster
+	flagGodMode
+	flagNoTarget
+	flagItem
+	flagOnGround
+	flagPartialGround
+	flagWaterJump
+	flagJumpReleased
+)
+
+// Bits of the items field.
+const (
+	itemShotgun = 1 << iota
+	itemSuperShotgun
+	itemNailgun
+	itemSuperNailgun
+	itemGrenadeLauncher
+	itemRocketLauncher
+	itemLightning
+	itemSuperLightning
+	itemShells
+	itemNails
+	itemRockets
+	itemCells
+	itemAxe
+	itemArmor1
+	itemArmor2
+	itemArmor3
+	itemSuperHealth
+	itemKey1
+	itemKey2
+	itemInvisibility
+	itemInvulnerability
+	itemSuit
+	itemQuad
+)
+
+type Edict struct {
+	Free bool
+	// area
+
+	LeafCount int32
+	LeafNums  [maxEntLeafs]int16
+	State     EntityState
+	V         prog.EntVars
+}
+
+// allocEdicts gives the level the world's edict and a free one for each
+// client slot, as SV_SpawnServer does before the map's entities are spawned.
+func (s *Server) allocEdicts() {
+	s.Edicts = make([]Edict, maxPlayers+1)
+	for i := 1; i < len(s.Edicts); i++ {
+		s.Edicts[i].Free = true
+	}
+}
+
+// spawnEdict puts the client into the level as Host_Spawn_f does, and with
+// the player's defaults that the game's PutClientInServer would set if a game
+// VM ran, unless the game mode vetoes it.
+func (s *Server) spawnEdict(sess *Session) {
+	n := sess.Slot + 1
+	if n >= len(s.Edicts) {
+		return
+	}
+	s.Edicts[n] = Edict{}
+	v := &s.Edicts[n].V
+	v.ColorMap = Float(sess.Slot + 1)
+	v.Team = Float(sess.Player.Colors&15 + 1)
+	v.NetName = s.progStrings.Set(sess.Player.Name)
+	v.Frags = Float(sess.Player.Frags)
+	v.Health, v.MaxHealth = 100, 100
+	v.TakeDamage = damageAim
+	v.Solid = solidSlideBox
+	v.MoveType = moveTypeWalk
+	v.Flags = flagClient
+	v.Items = itemShotgun | itemAxe
+	v.Weapon = itemShotgun
+	v.AmmoShells, v.CurrentAmmo = 25, 25
+	if !s.Spawn(&s.Edicts[n]) {
+		s.Edicts[n] = Edict{Free: true}
+	}
+}
+
+// damage does damage to target on behalf of attacker, as the game mode
+// allows, and reports whether it killed target.  It stands in for the
+// health accounting of the game's T_Damage.
+func (s *Server) damage(target, attacker *Edict, damage float32) bool {
+	if target.V.TakeDamage == damageNo {
+		return false
+	}
+	if damage = s.Damage(target, attacker, damage); damage <= 0 {
+		return false
+	}
+	s.countHit(target, attacker)
+	target.V.Health -= Float(damage)
+	return target.V.Health <= 0
+}
+
+const numPingTimes = 16
+
+type Player struct {
+	Name        string
+	Colors      int
+	Frags       int
+	Team        int
+	ConnectTime time.Time
+
+	flood          floodProt
+	lastInfoChange time.Time
+	buttons        int8
+	nextShot       time.Duration // level time at which the weapon may fire again
+	shotHit        bool          // whether the last shot counted has hit
+	lastVote       time.Time
+	sprinted       string // incomplete line printed by the game
+	creditedTime   time.Time
+	pingTimes      [numPingTimes]float32
+	numPings       int
+}
+
+// AddPing records the round trip of a client move in seconds.
+func (p *Player) AddPing(t float32) {
+	p.pingTimes[p.numPings%numPingTimes] = t
+	p.numPings++
+}
+
+// Ping reports the average round trip of the recent client moves in seconds.
+func (p *Player) Ping() float32 {
+	n := p.numPings
+	if n == 0 {
+		return 0
+	}
+	if n > numPingTimes {
+		n = numPingTimes
+	}
+	var total float32
+	for _, t := range p.pingTimes[:n] {
+		total += t
+	}
+	return total / float32(n)
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"github.com/matttproud/go-quake/cvar"
+	"github.com/matttproud/go-quake/prog"
+)
+
+// engineStrings holds the strings that the server hands the game, such as
+// the players' names, which are referred to by negative offsets as those of
+// PR_SetEngineString are.
+type engineStrings struct {
+	vals []string
+	offs map[string]prog.String
+}
+
+func (e *engineStrings) Set(v string) prog.String {
+	if off, ok := e.offs[v]; ok {
+		return off
+	}
+	if e.offs == nil {
+		e.offs = make(map[string]prog.String)
+	}
+	e.vals = append(e.vals, v)
+	off := prog.String(-len(e.vals))
+	e.offs[v] = off
+	return off
+}
+
+func (e *engineStrings) Get(off prog.String) string {
+	if i := -int(off) - 1; i >= 0 && i < len(e.vals) {
+		return e.vals[i]
+	}
+	return ""
+}
+
+func (s *Server) initProg() {
+	s.addCommand("edict", noImpl)
+	s.addCommand("edicts", noImpl)
+	s.addCommand("edictcount", noImpl)
+	s.addCommand("profile", noImpl)
+
+	s.newFloat("nomonsters", 0)
+	s.newFloat("gamecfg", 0)
+	s.newFloat("scratch1", 0)
+	s.newFloat("scratch2", 0)
+	s.newFloat("scratch3", 0)
+	s.newFloat("scratch4", 0)
+	s.newFloat("savedgamecfg", 0, cvar.Saved)
+	s.newFloat("saved1", 0, cvar.Saved)
+	s.newFloat("saved2", 0, cvar.Saved)
+	s.newFloat("saved3", 0, cvar.Saved)
+	s.newFloat("saved4", 0, cvar.Saved)
+}
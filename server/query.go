@@ -0,0 +1,83 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+)
+
+// Server, player and rule queries answer the server browsers of stock
+// clients and tools such as qstat.
+
+// readCtrlString consumes a NUL-terminated string from data.
+func readCtrlString(data []byte) (string, []byte) {
+	i := bytes.IndexByte(data, 0)
+	if i == -1 {
+		return string(data), nil
+	}
+	return string(data[:i]), data[i+1:]
+}
+
+func (s *Server) HandleServerInfo(addr net.Addr, data []byte) error {
+	game, data := readCtrlString(data)
+	if game != "QUAKE" {
+		return errInvalidCtrl("server info for game " + game)
+	}
+	if len(data) < 1 || data[0] != protonetquake.NetProtocolVersion {
+		return errInvalidProtocolVersion("server info")
+	}
+	msg := NewCtrlMsg(protonetquake.CCRepServerInfo)
+	msg.WriteString(s.Conn.LocalAddr().String())
+	msg.WriteString(s.cvHostname.Get())
+	msg.WriteString(s.Map)
+	msg.WriteByte(byte(s.Sessions.Len()))
+	msg.WriteByte(byte(s.MaxPlayers))
+	msg.WriteByte(protonetquake.NetProtocolVersion)
+	return msg.WriteTo(s.Conn, addr)
+}
+
+func (s *Server) HandlePlayerInfo(addr net.Addr, data []byte) error {
+	if len(data) < 1 {
+		return errInvalidCtrl("player info lacks player number")
+	}
+	n := int(data[0])
+	sessions := s.Sessions.Sorted()
+	if n >= len(sessions) {
+		return nil
+	}
+	sess := sessions[n]
+	msg := NewCtrlMsg(protonetquake.CCRepPlayerInfo)
+	msg.WriteByte(byte(n))
+	msg.WriteString(sess.Player.Name)
+	binary.Write(msg, binary.LittleEndian, int32(sess.Player.Colors))
+	binary.Write(msg, binary.LittleEndian, int32(sess.Player.Frags))
+	binary.Write(msg, binary.LittleEndian, int32(s.clock.Now().Sub(sess.Player.ConnectTime)/time.Second))
+	msg.WriteString(sess.RemoteAddr.String())
+	return msg.WriteTo(s.Conn, addr)
+}
+
+// nextRule returns the server-side console variable following prev.
+func (s *Server) nextRule(prev string) (name, val string, ok bool) {
+	for _, n := range s.Cvars.Names() {
+		if prev != "" && n <= prev {
+			continue
+		}
+		if v, _ := s.Cvars.Lookup(n); v != nil && v.ServerSide() {
+			return n, v.String(), true
+		}
+	}
+	return "", "", false
+}
+
+func (s *Server) HandleRuleInfo(addr net.Addr, data []byte) error {
+	prev, _ := readCtrlString(data)
+	msg := NewCtrlMsg(protonetquake.CCRepRuleInfo)
+	if name, val, ok := s.nextRule(prev); ok {
+		msg.WriteString(name)
+		msg.WriteString(val)
+	}
+	return msg.WriteTo(s.Conn, addr)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+type recordingConn struct {
+	net.PacketConn
+	local  net.Addr
+	writes [][]byte
+}
+
+func (c *recordingConn) LocalAddr() net.Addr { return c.local }
+func (c *recordingConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	c.writes = append(c.writes, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func TestHandleServerInfo(t *testing.T) {
+	conn := &recordingConn{local: &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 26000}}
+	srv := newTestServer(t)
+	srv.Conn = conn
+	srv.Map = "e1m1"
+	srv.MaxPlayers = 4
+	srv.cvHostname.Set("test")
+	for _, test := range []struct {
+		req   []byte
+		reply []byte
+	}{
+		{
+			req:   []byte("QUAKE\x00\x03"),
+			reply: []byte("\x80\x00\x00\x21\x8310.0.0.1:26000\x00test\x00e1m1\x00\x00\x04\x03"),
+		},
+		{
+			req: []byte("QUAKE\x00\x02"),
+		},
+		{
+			req: []byte("HEXEN\x00\x03"),
+		},
+	} {
+		conn.writes = nil
+		err := srv.HandleServerInfo(nil, test.req)
+		if test.reply == nil {
+			if err == nil || len(conn.writes) != 0 {
+				t.Errorf("%q: got = %v %q, want error", test.req, err, conn.writes)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := conn.writes[0], test.reply; !bytes.Equal(got, want) {
+			t.Errorf("got = %q, want = %q", got, want)
+		}
+	}
+}
+
+func TestNextRule(t *testing.T) {
+	srv := newTestServer(t)
+	var (
+		prev  string
+		names []string
+	)
+	for {
+		name, _, ok := srv.nextRule(prev)
+		if !ok {
+			break
+		}
+		if name <= prev {
+			t.Fatalf("rule %q does not follow %q", name, prev)
+		}
+		v, _ := srv.Cvars.Lookup(name)
+		if !v.ServerSide() {
+			t.Errorf("rule %q is not server-side", name)
+		}
+		names = append(names, name)
+		prev = name
+	}
+	if len(names) == 0 {
+		t.Error("no rules")
+	}
+}
+
+func TestRuleInfoHidesPassword(t *testing.T) {
+	conn := &recordingConn{}
+	srv := newTestServer(t)
+	srv.Conn = conn
+	srv.cvPassword.Set("secret")
+	var prev string
+	for {
+		conn.writes = nil
+		if err := srv.HandleRuleInfo(nil, []byte(prev+"\x00")); err != nil {
+			t.Fatal(err)
+		}
+		reply := conn.writes[0][5:]
+		if len(reply) == 0 {
+			break
+		}
+		name, rest := readCtrlString(reply)
+		val, _ := readCtrlString(rest)
+		if name == "sv_password" || val == "secret" {
+			t.Fatalf("rule %q = %q reveals the password", name, val)
+		}
+		prev = name
+	}
+}
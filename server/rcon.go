@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/matttproud/go-quake/cvar"
+	"github.com/matttproud/go-quake/rcon"
+)
+
+// rconWindow bounds how far the clock of an rcon client may stray from ours
+// and thereby how long a nonce must be remembered.
+const rconWindow = 30 * time.Second
+
+type rconVars struct {
+	cvRconPassword *cvar.String
+}
+
+type errRconDisabled string
+
+func (e errRconDisabled) Error() string { return "rcon is disabled: " + string(e) }
+
+// rconNonces remembers the nonces of recently accepted requests.
+type rconNonces map[uint64]time.Time
+
+func (n rconNonces) Seen(nonce uint64, now time.Time) bool {
+	for k, exp := range n {
+		if now.After(exp) {
+			delete(n, k)
+		}
+	}
+	if _, ok := n[nonce]; ok {
+		return true
+	}
+	n[nonce] = now.Add(2 * rconWindow)
+	return false
+}
+
+// HandleRcon authenticates a remote console request and queues its command
+// onto the command buffer, from which its output is returned to addr.
+func (s *Server) HandleRcon(addr net.Addr, data []byte) error {
+	password := s.cvRconPassword.Get()
+	if password == "" {
+		return errRconDisabled(addr.String())
+	}
+	req, err := rcon.ParseRequest(data, password)
+	switch err {
+	case nil:
+	case rcon.ErrBadMAC:
+		s.sendRconReply(addr, req.Nonce, "Bad rcon_password.\n")
+		return errInvalidCtrl("bad rcon password")
+	default:
+		return errInvalidCtrl(err.Error())
+	}
+	now := s.clock.Now()
+	if d := now.Sub(req.Time); d > rconWindow || d < -rconWindow {
+		return errInvalidCtrl(fmt.Sprintf("rcon request is %v old", d))
+	}
+	if s.rconNonces == nil {
+		s.rconNonces = make(rconNonces)
+	}
+	if s.rconNonces.Seen(req.Nonce, now) {
+		return errInvalidCtrl("replayed rcon request")
+	}
+	s.log.Printf("rcon from %s: %s", addr, req.Command)
+	s.Cbuf.Add(func() {
+		var out bytes.Buffer
+		restore := s.con.redirect(&out)
+		err := s.Exec(req.Command)
+		restore()
+		if err != nil {
+			fmt.Fprintln(&out, err)
+		}
+		s.sendRconReply(addr, req.Nonce, out.String())
+	})
+	return nil
+}
+
+func (s *Server) sendRconReply(addr net.Addr, nonce uint64, text string) {
+	for _, p := range rcon.EncodeReply(nonce, text) {
+		if _, err := s.Conn.WriteTo(p, addr); err != nil {
+			s.log.Printf("could not reply to rcon from %s: %v", addr, err)
+			return
+		}
+	}
+}
+
+func (s *Server) initRcon() {
+	s.cvRconPassword = s.newString("rcon_password", "", cvar.Secret)
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matttproud/go-quake/rcon"
+)
+
+func TestHandleRcon(t *testing.T) {
+	conn := &recordingConn{}
+	addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 27001}
+	srv := newTestServer(t)
+	srv.Conn = conn
+	srv.cvHostname.Set("rcon test")
+	fresh, err := rcon.NewRequest("hostname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := &rcon.Request{Time: time.Now().Add(-time.Hour), Nonce: 1, Command: "hostname"}
+	for _, test := range []struct {
+		password string
+		req      *rcon.Request
+		sign     string
+		invalid  bool
+		reply    string
+	}{
+		{password: "", req: fresh, sign: "secret"},
+		{password: "secret", req: fresh, sign: "guess", invalid: true, reply: "Bad rcon_password.\n"},
+		{password: "secret", req: stale, sign: "secret", invalid: true},
+		{password: "secret", req: fresh, sign: "secret", reply: "\"hostname\" is \"rcon test\"\n"},
+		{password: "secret", req: fresh, sign: "secret", invalid: true},
+	} {
+		srv.cvRconPassword.Set(test.password)
+		conn.writes = nil
+		pkt := test.req.Encode(test.sign)
+		err := srv.HandleRcon(addr, pkt[5:])
+		if got, want := isInvalidCtrl(err), test.invalid; got != want {
+			t.Errorf("got = %v, want = %v", err, want)
+		}
+		srv.Frame(time.Now())
+		var reply []string
+		for _, w := range conn.writes {
+			r, err := rcon.ParseReply(w)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reply = append(reply, r.Text)
+		}
+		if got, want := strings.Join(reply, ""), test.reply; got != want {
+			t.Errorf("got = %q, want = %q", got, want)
+		}
+	}
+}
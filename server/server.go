@@ -0,0 +1,876 @@
+// Package server is an embeddable NetQuake server.  A Server is built with
+// New from a Config and owns its cvars, commands, sessions and metrics.
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/matttproud/go-quake/command"
+	"github.com/matttproud/go-quake/cvar"
+	"github.com/matttproud/go-quake/path"
+	"github.com/matttproud/go-quake/prog"
+	"github.com/matttproud/go-quake/proto/protonetquake"
+)
+
+type ServerState int
+
+const (
+	Invalid ServerState = iota
+	Waiting
+	Running
+	Stopping
+)
+
+func (s ServerState) String() string {
+	switch s {
+	case Waiting:
+		return "waiting"
+	case Running:
+		return "running"
+	case Stopping:
+		return "stopping"
+	}
+	return "invalid"
+}
+
+type Server struct {
+	Conn         net.PacketConn
+	State        ServerState
+	MaxPlayers   int
+	Sessions     SessionRegistry
+	Bans         *BanList
+	ChatLog      io.Writer
+	CloseOnce    sync.Once
+	Cbuf         Cbuf
+	Cvars        cvar.Registry
+	Commands     command.Registry
+	Assets       *path.Path
+	GameDir      string
+	Map          string
+	NextMap      string // to which the level's exit leads, if it has one
+	MapList      []string
+	Time         time.Duration // since the level began
+	Paused       bool
+	intermission intermission
+	vote         *vote
+	match        match
+	Events       io.Writer
+	Stats        *StatsStore
+	bprinted     string   // incomplete line printed by the game
+	obituaries   []string // printed by the game during this frame
+	Edicts       []Edict
+	progStrings  engineStrings
+	throttle     ctrlThrottle
+	rconNonces   rconNonces
+	lastFrame    time.Time
+	clock        Clock
+	log          *log.Logger
+	con          *console
+	metrics      metrics
+	// hostClient is the client whose command is running, as host_client
+	// is while the server reads a clc_stringcmd.  It is nil for console
+	// commands.
+	hostClient *Session
+	// cmdArgs is the raw text of the arguments of the command that is
+	// running, as Cmd_Args returns it.  It is empty for commands run
+	// without a line.
+	cmdArgs string
+	// parseClientCommand handles the client commands that the engine does
+	// not, as a game's SV_ParseClientCommand would.
+	parseClientCommand func(s *Session, args []string) error
+	listenSession      func() (net.PacketConn, error)
+	closers            []io.Closer
+	initErr            error
+	gameModes          map[string]GameMode
+	stop               chan struct{}
+	loops              sync.WaitGroup
+
+	hostVars
+	netVars
+	throttleVars
+	banVars
+	chatVars
+	cheatVars
+	gameModeVars
+	infoVars
+	levelVars
+	mapListVars
+	matchVars
+	rconVars
+	signonVars
+	voteVars
+}
+
+// Config configures a Server.  The zero value of each field selects a
+// default.
+type Config struct {
+	// Conn is the control socket on which clients connect.
+	Conn net.PacketConn
+	// ListenSession opens the socket that serves a newly connected client.
+	// By default, it is a UDP socket on an ephemeral port of localhost.
+	ListenSession func() (net.PacketConn, error)
+	// Assets are searched for game data such as progs.dat.
+	Assets *path.Path
+	// GameDir holds the ban and map lists, the statistics and the logs.
+	// Without it, the server reads and writes no files.
+	GameDir string
+	// Cvars and Commands are the registries to which the server adds its
+	// console variables and commands.  They must not already hold them.
+	Cvars    cvar.Registry
+	Commands command.Registry
+	Clock    Clock
+	Logger   *log.Logger
+	// Console receives the output of console commands.  It defaults to
+	// standard output.
+	Console io.Writer
+	// MaxPlayers is how many clients may be connected at once, up to 8.  It
+	// defaults to 1.
+	MaxPlayers int
+	// GameModes are the game modes that sv_gamemode may select, by name.
+	GameModes map[string]GameMode
+}
+
+func listenLocal() (net.PacketConn, error) {
+	laddr, err := LocalAddr()
+	if err != nil {
+		return nil, err
+	}
+	return net.ListenUDP("udp", laddr)
+}
+
+// maxPlayers is the most players that a server admits.
+const maxPlayers = 8
+
+// New creates a server as cfg describes.  It is ready for Loop.
+func New(cfg Config) (*Server, error) {
+	s := &Server{
+		Conn:          cfg.Conn,
+		State:         Waiting,
+		MaxPlayers:    cfg.MaxPlayers,
+		Sessions:      make(SessionRegistry),
+		Bans:          new(BanList),
+		Stats:         newStatsStore(""),
+		Cvars:         cfg.Cvars,
+		Commands:      cfg.Commands,
+		Assets:        cfg.Assets,
+		GameDir:       cfg.GameDir,
+		clock:         cfg.Clock,
+		log:           cfg.Logger,
+		con:           &console{w: cfg.Console},
+		metrics:       newMetrics(),
+		listenSession: cfg.ListenSession,
+		stop:          make(chan struct{}),
+	}
+	s.parseClientCommand = s.logClientCommand
+	if s.MaxPlayers == 0 {
+		s.MaxPlayers = 1
+	}
+	if s.MaxPlayers < 1 || s.MaxPlayers > maxPlayers {
+		return nil, fmt.Errorf("max players %d is not between 1 and %d", s.MaxPlayers, maxPlayers)
+	}
+	if s.Cvars == nil {
+		s.Cvars = cvar.New()
+	}
+	if s.Commands == nil {
+		s.Commands = command.New()
+	}
+	if s.clock == nil {
+		s.clock = systemClock{}
+	}
+	if s.log == nil {
+		s.log = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	if s.con.w == nil {
+		s.con.w = os.Stdout
+	}
+	if s.listenSession == nil {
+		s.listenSession = listenLocal
+	}
+	for _, fn := range []func(){
+		s.initCommon, s.initHost, s.initNet, s.initThrottle, s.initCmd,
+		s.initConsole, s.initHostCmds, s.initSignon, s.initChat,
+		s.initCheats, s.initBanList, s.initRcon, s.initIntermission,
+		s.initMapList, s.initVote, s.initMatch, s.initStats,
+		s.initGameMode, s.initProg, s.initPhys, s.initView, s.initChase,
+		s.initKeys, s.initMenu,
+	} {
+		fn()
+	}
+	if s.initErr != nil {
+		return nil, s.initErr
+	}
+	for name, m := range cfg.GameModes {
+		if err := s.RegisterGameMode(name, m); err != nil {
+			return nil, err
+		}
+	}
+	s.throttle = ctrlThrottle{vars: &s.throttleVars, dropped: s.metrics.ctrlDropped, log: s.log}
+	s.allocEdicts()
+	if err := s.loadProgs(); err != nil {
+		return nil, err
+	}
+	if err := s.openFiles(); err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadProgs prepares the game virtual machine from the assets, if any.
+func (s *Server) loadProgs() error {
+	if s.Assets == nil {
+		return nil
+	}
+	progs, err := s.Assets.Load("progs.dat")
+	if err != nil {
+		return err
+	}
+	_, err = prog.Open(progs)
+	return err
+}
+
+// openFiles loads the lists and statistics from the game directory and
+// opens the logs there.
+func (s *Server) openFiles() error {
+	if s.GameDir == "" {
+		return nil
+	}
+	var err error
+	if s.Bans, err = LoadBanList(s.path(banFile)); err != nil {
+		return err
+	}
+	if s.MapList, err = LoadMapList(s.path(mapListFile)); err != nil {
+		return err
+	}
+	if s.Stats, err = LoadStats(s.path(statsFile)); err != nil {
+		return err
+	}
+	chatLog, err := OpenLog(s.path(chatFile))
+	if err != nil {
+		return err
+	}
+	s.ChatLog = chatLog
+	s.closers = append(s.closers, chatLog)
+	events, err := OpenLog(s.path(eventFile))
+	if err != nil {
+		return err
+	}
+	s.Events = events
+	s.closers = append(s.closers, events)
+	return nil
+}
+
+func (s *Server) closeFiles() {
+	for _, c := range s.closers {
+		if err := c.Close(); err != nil {
+			s.log.Println(err)
+		}
+	}
+	s.closers = nil
+}
+
+// path names a file in the game directory.
+func (s *Server) path(name string) string { return filepath.Join(s.GameDir, name) }
+
+// Reliable queues msg for every client, as writes to sv.reliable_datagram do.
+func (s *Server) Reliable(msg []byte) {
+	for _, sess := range s.Sessions {
+		sess.Message.Write(msg)
+	}
+}
+
+// BroadcastPrintf prints text on every client's console through Bprint, as
+// SV_BroadcastPrintf does.
+func (s *Server) BroadcastPrintf(format string, args ...interface{}) {
+	s.Bprint(fmt.Sprintf(format, args...))
+}
+
+// CenterPrintf shows text in the middle of every client's screen.
+func (s *Server) CenterPrintf(format string, args ...interface{}) {
+	var m Message
+	m.WriteByte(protonetquake.SVCCenterPrint)
+	m.WriteCString(fmt.Sprintf(format, args...))
+	s.Reliable(m.Bytes())
+}
+
+// edictSession returns the client whose edict e is, if any.
+func (s *Server) edictSession(e *Edict) *Session {
+	for _, sess := range s.Sessions {
+		if s.clientEdict(sess) == e {
+			return sess
+		}
+	}
+	return nil
+}
+
+// clientEdict returns the edict of the client in s, if the client has been
+// put into the level.
+func (s *Server) clientEdict(sess *Session) *Edict {
+	if n := sess.Slot + 1; n < len(s.Edicts) && !s.Edicts[n].Free {
+		return &s.Edicts[n]
+	}
+	return nil
+}
+
+// Close stops the loop, disconnects every client and saves the server's
+// files.
+func (s *Server) Close() {
+	s.CloseOnce.Do(func() {
+		s.State = Stopping
+		close(s.stop)
+		s.loops.Wait()
+		s.Sessions.Close()
+		s.saveStats()
+		s.closeFiles()
+		if s.Conn == nil {
+			return
+		}
+		if err := s.Conn.Close(); err != nil {
+			s.log.Println(err)
+		}
+	})
+}
+
+func LocalAddr() (*net.UDPAddr, error) { return net.ResolveUDPAddr("udp", "localhost:0") }
+
+func AcceptConnect(ctrl net.PacketConn, addr net.Addr, port int) error {
+	msg := NewCtrlMsg(protonetquake.CCRepAccept)
+	if err := binary.Write(msg, binary.LittleEndian, int32(port)); err != nil {
+		return err
+	}
+	return msg.WriteTo(ctrl, addr)
+}
+
+func (s *Server) HandleConnect(ctx context.Context, addr net.Addr, data []byte) error {
+	err := ValidateConnect(data)
+	switch err.(type) {
+	case nil:
+		s.log.Printf("Successfully validated connection from %s", addr)
+	case errInvalidCtrl:
+		s.metrics.connects.With("invalid").Inc()
+		return err
+	case errInvalidProtocolVersion:
+		s.metrics.connects.With("incompatible").Inc()
+		return RejectConnectIncompatible(s.Conn, addr)
+	default:
+		return err
+	}
+	if _, ok := s.Sessions.Find(addr); ok {
+		s.metrics.connects.With("duplicate").Inc()
+		return s.ReinformDuplicate(addr)
+	}
+	if reason, barred := s.Bans.Check(addrIP(addr), s.clock.Now(), s.cvAllowList.Get() != 0); barred {
+		s.metrics.connects.With("banned").Inc()
+		return RejectConnect(s.Conn, addr, reason)
+	}
+	if s.IsFull() {
+		s.metrics.connects.With("full").Inc()
+		return RejectConnectCapacity(s.Conn, addr)
+	}
+	if s.Sessions.HalfOpen() >= int(s.cvMaxHalfOpen.Get()) {
+		s.metrics.connects.With("half_open").Inc()
+		return RejectConnectPending(s.Conn, addr)
+	}
+	if reason := s.mode().ClientConnect(s, addr); reason != "" {
+		s.metrics.connects.With("game_mode").Inc()
+		return RejectConnect(s.Conn, addr, reason)
+	}
+	sess, err := s.Sessions.NewSession(ctx, s, addr)
+	switch err.(type) {
+	case nil:
+		s.log.Printf("Created new session for %s", addr)
+	case errDuplSession:
+		s.metrics.connects.With("duplicate").Inc()
+		return s.ReinformDuplicate(addr)
+	default:
+		return err
+	}
+	if err := AcceptConnect(s.Conn, addr, sess.LocalPort); err != nil {
+		return s.Sessions.Disconnect(sess.RemoteAddr)
+	}
+	remove := sess.Remove
+	sess.Remove = func() {
+		if _, ok := s.Sessions[sess.Id]; ok {
+			s.mode().ClientDisconnect(s, sess)
+			s.logEvent("disconnect", sess, nil, "")
+			if sess.Spawned {
+				s.Stats.AddPlayTime(sess, s.clock.Now())
+			}
+			if e := s.clientEdict(sess); e != nil {
+				*e = Edict{Free: true}
+			}
+		}
+		remove()
+	}
+	sess.SendServerInfo(s)
+	s.logEvent("connect", sess, nil, "")
+	s.metrics.connects.With("accepted").Inc()
+	s.log.Printf("Redirected %s to new session %s", addr, sess.LocalAddr)
+	return nil
+}
+
+func (s *Server) IsFull() bool {
+	return s.Sessions.Len() == s.MaxPlayers
+}
+
+func (s *Server) ReinformDuplicate(addr net.Addr) error {
+	sess, ok := s.Sessions.Find(addr)
+	if !ok {
+		return nil
+	}
+	return AcceptConnect(s.Conn, addr, sess.LocalPort)
+}
+
+type errShortWrite string
+
+func (e errShortWrite) Error() string { return "short write: " + string(e) }
+
+func newErrShortWrite(n, sz int) errShortWrite {
+	return errShortWrite(fmt.Sprintf("wrote %v, expected %v", n, sz))
+}
+
+func RejectConnectCapacity(conn net.PacketConn, addr net.Addr) error {
+	const msg = "Server is full.\n"
+	return RejectConnect(conn, addr, msg)
+}
+
+func RejectConnectPending(conn net.PacketConn, addr net.Addr) error {
+	const msg = "Too many pending connections.\n"
+	return RejectConnect(conn, addr, msg)
+}
+
+func RejectConnectIncompatible(conn net.PacketConn, addr net.Addr) error {
+	const msg = "Incompatible version.\n"
+	return RejectConnect(conn, addr, msg)
+}
+
+func RejectConnect(conn net.PacketConn, addr net.Addr, reason string) error {
+	msg := NewCtrlMsg(protonetquake.CCRepReject)
+	if _, err := msg.WriteString(reason); err != nil {
+		return err
+	}
+	return msg.WriteTo(conn, addr)
+}
+
+func ValidateConnect(data []byte) error {
+	var connectMagic = [6]byte{'Q', 'U', 'A', 'K', 'E', 0}
+	const restConnSz = len(connectMagic) + 1
+	if len(data) < restConnSz {
+		return errInvalidCtrl(fmt.Sprintf(
+			"residual body %v of %v was shorter than expected %v", data, data, restConnSz))
+	}
+	if !bytes.Equal(connectMagic[:], data[:len(connectMagic)]) {
+		return errInvalidCtrl(fmt.Sprintf(
+			"residual body %v of %v lacked expected magic %v", data[:len(connectMagic)], data, connectMagic))
+	}
+	data = data[len(connectMagic):]
+	if data[0] != protonetquake.NetProtocolVersion {
+		return errInvalidProtocolVersion(fmt.Sprintf(
+			"protocol %v does not match %v", data[0], protonetquake.NetProtocolVersion))
+	}
+	return nil
+}
+
+func (s *Server) Frame(t time.Time) error {
+	start := s.clock.Now()
+	if !s.lastFrame.IsZero() && !s.Paused {
+		s.Time += t.Sub(s.lastFrame)
+	}
+	s.lastFrame = t
+	s.mode().FrameStart(s)
+	s.Cbuf.Execute()
+	s.RunClients(t)
+	s.warmupRespawns()
+	s.syncFrags()
+	if !s.Paused {
+		s.runMatch()
+		s.runRules()
+	}
+	s.runVote(t)
+	s.mode().FrameEnd(s)
+	s.metrics.frameSeconds.Observe(s.clock.Now().Sub(start).Seconds())
+	return nil
+}
+
+// RunClients processes what each client has sent since the last frame and
+// sends each its pending reliable s.Commands.
+func (s *Server) RunClients(t time.Time) {
+	for _, sess := range s.Sessions {
+		if err := sess.loop(); err != nil {
+			s.log.Printf("Dropping %v: %v", sess.Id, err)
+			sess.Drop("")
+			continue
+		}
+		if sess.timedOut(t) {
+			s.log.Printf("Timing out %v", sess.Id)
+			sess.Remove()
+			continue
+		}
+		if sess.AuthExpired(t) {
+			sess.Drop("No password was supplied.\n")
+			continue
+		}
+		if err := sess.sendFrame(t); err != nil {
+			s.log.Printf("Dropping %v: %v", sess.Id, err)
+			sess.Remove()
+			continue
+		}
+		if err := sess.keepalive(t); err != nil {
+			s.log.Printf("Keepalive to %v: %v", sess.Id, err)
+		}
+	}
+}
+
+func (s *Server) EdictsInUse() int {
+	var n int
+	for i := range s.Edicts {
+		if !s.Edicts[i].Free {
+			n++
+		}
+	}
+	return n
+}
+
+// Do runs fn on the host frame and waits for it to complete.
+func (s *Server) Do(ctx context.Context, fn func()) error {
+	done := make(chan struct{})
+	s.Cbuf.Add(func() {
+		defer close(done)
+		fn()
+	})
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return nil
+	}
+}
+
+func (s *Server) cmdMaxPlayers(args ...string) error {
+	if s.State != Waiting {
+		return fmt.Errorf("may only changed when server is idle")
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected one numeric argument")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return err
+	}
+	if n < 1 || n > maxPlayers {
+		return fmt.Errorf("expected value between 1 and %d", maxPlayers)
+	}
+	s.MaxPlayers = n
+	return nil
+}
+
+type Ctrl struct {
+	Cmd  int
+	Data []byte
+}
+
+type ErrNotCtrl string
+
+func (e ErrNotCtrl) Error() string { return "not control packet: " + string(e) }
+
+type ErrWrongLen string
+
+func (e ErrWrongLen) Error() string { return string(e) }
+
+func NewErrWrongLen(got, want int) ErrWrongLen {
+	return ErrWrongLen(fmt.Sprintf("wrong size: got %v, want %v", got, want))
+}
+
+func DecodeCtrl(data []byte) (*Ctrl, error) {
+	if len(data) < 5 {
+		return nil, ErrNotCtrl("too short")
+	}
+	ctrl := uint32(binary.BigEndian.Uint32(data[0:4]))
+	if int32(ctrl) == -1 {
+		return nil, ErrNotCtrl("invalid control signature")
+	}
+	if ctrl&^protonetquake.NetflagLengthMask != protonetquake.NetflagControl {
+		return nil, ErrNotCtrl("lacks bitmask")
+	}
+	if got, want := int(ctrl&protonetquake.NetflagLengthMask), len(data); got != want {
+		return nil, NewErrWrongLen(got, want)
+	}
+	return &Ctrl{Cmd: int(data[4]), Data: data[5:]}, nil
+}
+
+// ctrlPacket is a datagram read from the control socket.
+type ctrlPacket struct {
+	data []byte
+	addr net.Addr
+	err  error
+}
+
+// readControl feeds datagrams from the control socket to out until the socket
+// fails or ctx ends.
+func (s *Server) readControl(ctx context.Context, out chan<- ctrlPacket) {
+	for {
+		var data [512]byte
+		n, addr, err := s.Conn.ReadFrom(data[:])
+		select {
+		case out <- ctrlPacket{data: data[:n], addr: addr, err: err}:
+		case <-ctx.Done():
+			return
+		}
+		if err != nil && !isErrTransient(err) {
+			return
+		}
+	}
+}
+
+func (s *Server) handleControlSocket(ctx context.Context) error {
+	pkts := make(chan ctrlPacket)
+	go s.readControl(ctx, pkts)
+	tick := s.clock.After(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick:
+			if err := s.Frame(s.clock.Now()); err != nil {
+				return err
+			}
+			tick = s.clock.After(time.Duration(float32(time.Second) * s.sysTicRate.Get()))
+		case p := <-pkts:
+			if p.err != nil {
+				if !isErrTransient(p.err) {
+					return p.err
+				}
+				continue
+			}
+			s.handleCtrlPacket(ctx, p)
+		}
+	}
+}
+
+func (s *Server) handleCtrlPacket(ctx context.Context, p ctrlPacket) {
+	now := s.clock.Now()
+	s.throttle.Sweep(now)
+	if !s.throttle.Allow(p.addr, now) {
+		return
+	}
+	ctrl, err := DecodeCtrl(p.data)
+	if err != nil {
+		s.throttle.Strike(p.addr, now)
+		return
+	}
+	if err := s.handleCtrl(ctx, p.addr, ctrl); err != nil {
+		s.log.Printf("control request from %s: %v", p.addr, err)
+		if isInvalidCtrl(err) {
+			s.throttle.Strike(p.addr, now)
+		}
+	}
+}
+
+type errUnknownCtrl int
+
+func (e errUnknownCtrl) Error() string { return fmt.Sprintf("unknown control command %#x", int(e)) }
+
+// isInvalidCtrl reports whether err stems from a malformed request rather than
+// from an honest client or the server itself.
+func isInvalidCtrl(err error) bool {
+	switch err.(type) {
+	case errInvalidCtrl, errUnknownCtrl:
+		return true
+	}
+	return false
+}
+
+func (s *Server) handleCtrl(ctx context.Context, addr net.Addr, ctrl *Ctrl) error {
+	switch ctrl.Cmd {
+	case int(protonetquake.CCReqConnect):
+		return s.HandleConnect(ctx, addr, ctrl.Data)
+	case protonetquake.CCReqServerInfo:
+		return s.HandleServerInfo(addr, ctrl.Data)
+	case protonetquake.CCReqPlayerInfo:
+		return s.HandlePlayerInfo(addr, ctrl.Data)
+	case protonetquake.CCReqRuleInfo:
+		return s.HandleRuleInfo(addr, ctrl.Data)
+	case protonetquake.CCReqRcon:
+		return s.HandleRcon(addr, ctrl.Data)
+	}
+	return errUnknownCtrl(ctrl.Cmd)
+}
+
+// Loop serves clients until ctx is done or the server is closed.
+func (s *Server) Loop(ctx context.Context) error {
+	s.loops.Add(1)
+	defer s.loops.Done()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return s.handleControlSocket(ctx)
+}
+
+// Listen opens a control socket on port of localhost.
+func Listen(port int) (net.PacketConn, error) {
+	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		return nil, err
+	}
+	return net.ListenUDP("udp", addr)
+}
+
+type errInvalidCtrl string
+
+func (e errInvalidCtrl) Error() string { return "invalid control message: " + string(e) }
+
+type errInvalidProtocolVersion string
+
+func (e errInvalidProtocolVersion) Error() string { return "invalid protocol version: " + string(e) }
+
+type CtrlMsg struct {
+	Cmd     byte
+	Msg     []byte
+	Payload *bytes.Buffer
+}
+
+func NewCtrlMsg(cmd byte) *CtrlMsg {
+	var payload = [5]byte{0, 0, 0, 0, cmd}
+	return &CtrlMsg{Cmd: cmd, Payload: bytes.NewBuffer(payload[:])}
+}
+
+func (m *CtrlMsg) checkMsg() error {
+	if m.Msg == nil {
+		return nil
+	}
+	return fmt.Errorf("already materialized")
+}
+
+func (m *CtrlMsg) Write(p []byte) (n int, err error) {
+	if err := m.checkMsg(); err != nil {
+		return 0, err
+	}
+	return m.Payload.Write(p)
+}
+
+func (m *CtrlMsg) WriteByte(p byte) error {
+	if err := m.checkMsg(); err != nil {
+		return err
+	}
+	return m.Payload.WriteByte(p)
+}
+
+func (m *CtrlMsg) WriteString(p string) (n int, err error) {
+	if err := m.checkMsg(); err != nil {
+		return 0, err
+	}
+	cnt, err := m.Payload.WriteString(p)
+	if err != nil {
+		return cnt, err
+	}
+	n += cnt
+	err = m.Payload.WriteByte(byte(0))
+	if err != nil {
+		return n, err
+	}
+	return n + cnt, nil
+}
+
+func (m *CtrlMsg) Bytes() []byte {
+	if m.Msg != nil {
+		return m.Msg
+	}
+	m.Msg = m.Payload.Bytes()
+	ctrl := protonetquake.NetflagControl | (uint32(len(m.Msg)) & protonetquake.NetflagLengthMask)
+	binary.BigEndian.PutUint32(m.Msg[0:4], ctrl)
+	m.Payload.Reset()
+	m.Payload = nil
+	return m.Msg
+}
+
+func (m *CtrlMsg) WriteTo(conn net.PacketConn, addr net.Addr) error {
+	msg := m.Bytes()
+	n, err := conn.WriteTo(msg, addr)
+	if err != nil {
+		return err
+	}
+	if n != len(msg) {
+		return newErrShortWrite(n, len(msg))
+	}
+	return nil
+}
+
+var errShortRead = errors.New("short read")
+
+func readDatagram(conn net.PacketConn, out []byte) ([]byte, error) {
+	var buf [protonetquake.MaxDatagram]byte
+	n, _, err := conn.ReadFrom(buf[:])
+	if err != nil {
+		/*if !isErrTransient(err) {
+			fmt.Println("c", err)
+			return nil, err
+		}*/
+		return nil, err
+	}
+	out = append(out, buf[:n]...)
+	if len(out) < protonetquake.NetHeaderSize {
+		return nil, errShortRead
+	}
+	return out, nil
+}
+
+type datagram struct {
+	seq   int
+	data  []byte
+	flags uint32
+}
+
+func (p *datagram) Len() int        { return len(p.data) }
+func (p *datagram) Seq() int        { return p.seq }
+func (p *datagram) IsNetCtrl() bool { return p.flags&protonetquake.NetflagControl != 0 }
+func (p *datagram) Data() []byte    { return p.data }
+
+func (p *datagram) IsUnreliable() bool { return p.flags&protonetquake.NetflagUnreliable != 0 }
+
+func (p *datagram) Before(seq int) bool { return p.seq < seq }
+func (p *datagram) At(seq int) bool     { return p.seq == seq }
+func (p *datagram) After(seq int) bool  { return p.seq > seq }
+
+func decodePacketBuf(data []byte) (*datagram, error) {
+	strm := bytes.NewReader(data)
+	var pbuf struct {
+		Len uint32
+		Seq uint32
+	}
+	if err := binary.Read(strm, binary.BigEndian, &pbuf); err != nil {
+		return nil, err
+	}
+	if pbuf.Len&protonetquake.NetflagLengthMask < protonetquake.NetHeaderSize {
+		return nil, errShortRead
+	}
+	p := (pbuf.Len & protonetquake.NetflagLengthMask) - protonetquake.NetHeaderSize
+	dbuf := make([]byte, int(p))
+	if _, err := io.ReadFull(strm, dbuf); err != nil {
+		return nil, err
+	}
+	pb := &datagram{
+		data:  dbuf,
+		flags: uint32(pbuf.Len) &^ protonetquake.NetflagLengthMask,
+		seq:   int(pbuf.Seq),
+	}
+	return pb, nil
+}
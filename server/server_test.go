@@ -0,0 +1,148 @@
+package server
+
+import (
+	"io"
+	"log"
+	"reflect"
+	"testing"
+
+	"github.com/matttproud/go-quake/cvar"
+
+	. "github.com/matttproud/go-quake/qtype"
+)
+
+// newTestServer returns a server that neither listens nor keeps files.
+func newTestServer(t *testing.T) *Server {
+	s, err := New(Config{Logger: log.New(io.Discard, "", 0), Console: io.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestNew(t *testing.T) {
+	a, b := newTestServer(t), newTestServer(t)
+	if err := a.Exec("hostname alpha; deathmatch 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Exec("hostname beta"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := a.cvHostname.Get(), "alpha"; got != want {
+		t.Errorf("a hostname = %q, want = %q", got, want)
+	}
+	if got, want := b.cvHostname.Get(), "beta"; got != want {
+		t.Errorf("b hostname = %q, want = %q", got, want)
+	}
+	if got := b.cvDeathmatch.Get(); got != 0 {
+		t.Errorf("b deathmatch = %v, want = 0", got)
+	}
+
+	cvars := cvar.New()
+	cvars.NewFloat("teamplay", 1)
+	if _, err := New(Config{Cvars: cvars, Logger: log.New(io.Discard, "", 0)}); err == nil {
+		t.Error("New accepted a registry that already holds teamplay")
+	}
+}
+
+func TestMaxPlayers(t *testing.T) {
+	srv := newTestServer(t)
+	for _, test := range []struct {
+		args []string
+		err  bool
+		want int
+	}{
+		{nil, true, 1},
+		{[]string{"4"}, false, 4},
+		{[]string{"0"}, true, 4},
+		{[]string{"9"}, true, 4},
+		{[]string{"x"}, true, 4},
+		{[]string{"2", "3"}, true, 4},
+	} {
+		err := srv.cmdMaxPlayers(test.args...)
+		if got := err != nil; got != test.err {
+			t.Errorf("maxplayers %q: err = %v, want error %v", test.args, err, test.err)
+		}
+		if got := srv.MaxPlayers; got != test.want {
+			t.Errorf("maxplayers %q: got = %d, want = %d", test.args, got, test.want)
+		}
+	}
+}
+
+func TestDecodeCtrl(t *testing.T) {
+	for _, test := range []struct {
+		data []byte
+		ctrl *Ctrl
+		err  error
+	}{
+		{
+			data: []byte{},
+			ctrl: nil,
+			err:  ErrNotCtrl("too short"),
+		},
+		{
+			data: []byte{128, 0, 0, 12, 1, 81, 85, 65, 75, 69, 0, 3},
+			ctrl: &Ctrl{Cmd: 1, Data: []byte{81, 85, 65, 75, 69, 0, 3}},
+			err:  nil,
+		},
+		{
+			data: []byte{255, 255, 255, 255, 0},
+			ctrl: nil,
+			err:  ErrNotCtrl("invalid control signature"),
+		},
+		{
+			data: []byte{128, 0, 0, 13, 1, 81, 85, 65, 75, 69, 0, 3},
+			ctrl: nil,
+			err:  NewErrWrongLen(13, 12),
+		},
+	} {
+		ctrl, err := DecodeCtrl(test.data)
+		if got, want := ctrl, test.ctrl; !reflect.DeepEqual(got, want) {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+		if got, want := err, test.err; got != want {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+	}
+}
+
+func TestSpawnEdict(t *testing.T) {
+	srv := newTestServer(t)
+	srv.cvCheats.Set(1)
+	sess, _ := newTestSession(srv, &recordingConn{})
+	sess.Slot = 2
+	sess.Player.Name = "Ranger"
+	sess.Player.Colors = 0x4d
+	srv.Sessions[sess.Id] = sess
+	if srv.clientEdict(sess) != nil {
+		t.Fatal("edict in use before spawning")
+	}
+
+	for _, cmd := range []string{"prespawn", "spawn", "begin", "god"} {
+		srv.ExecClient(sess, []string{cmd})
+	}
+	e := srv.clientEdict(sess)
+	if e == nil {
+		t.Fatal("no edict after spawning")
+	}
+	if got, want := srv.progStrings.Get(e.V.NetName), "Ranger"; got != want {
+		t.Errorf("netname = %q, want = %q", got, want)
+	}
+	if got, want := e.V.ColorMap, Float(3); got != want {
+		t.Errorf("colormap = %v, want = %v", got, want)
+	}
+	if got, want := e.V.Team, Float(14); got != want {
+		t.Errorf("team = %v, want = %v", got, want)
+	}
+	if int(e.V.Flags)&flagGodMode == 0 {
+		t.Error("god had no effect on the spawned edict")
+	}
+
+	srv.Map = "e1m1"
+	if err := srv.ChangeLevel("e1m1"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.clientEdict(sess) != nil {
+		t.Error("edict in use after the level changed")
+	}
+}
@@ -0,0 +1,406 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+)
+
+type SessionBuf struct {
+	ops []instruction
+	mtx sync.Mutex
+}
+
+func SessionId(addr net.Addr) string { return addr.String() }
+
+type errDuplSession string
+
+func (e errDuplSession) Error() string { return "duplicate session: " + string(e) }
+
+type SessionRegistry map[string]*Session
+
+func (r SessionRegistry) Len() int { return len(r) }
+
+// NewSession serves the client at addr on a socket of its own, which srv
+// opens.
+func (r SessionRegistry) NewSession(ctx context.Context, srv *Server, addr net.Addr) (*Session, error) {
+	id := SessionId(addr)
+	if _, ok := r[id]; ok {
+		return nil, errDuplSession(id)
+	}
+	conn, err := srv.listenSession()
+	if err != nil {
+		return nil, err
+	}
+	port, err := addrPort(conn.LocalAddr())
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	now := srv.clock.Now()
+	ses := &Session{
+		Cancel:     cancel,
+		Id:         id,
+		Slot:       r.freeSlot(),
+		Conn:       conn,
+		RemoteAddr: addr,
+		LocalAddr:  conn.LocalAddr(),
+		LocalPort:  port,
+		Player:     Player{Name: "unconnected", ConnectTime: now},
+		Remove: func() {
+			srv.log.Printf("Disconnecting %v...", addr)
+			r.Disconnect(addr)
+			srv.log.Printf("Disconnected %v", addr)
+		},
+		srv:           srv,
+		lastMessage:   now,
+		disconnectSig: make(chan struct{}),
+	}
+	r[id] = ses
+	go func() {
+		if err := ses.Loop(ctx); err != nil {
+			srv.log.Printf("Closing session from error %v", err)
+			return
+		}
+		srv.log.Printf("Closing session normally")
+	}()
+	return ses, nil
+}
+
+// addrPort returns the port of addr, which needn't be a UDP address.
+func addrPort(addr net.Addr) (int, error) {
+	if u, ok := addr.(*net.UDPAddr); ok {
+		return u.Port, nil
+	}
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(port)
+}
+
+type errUnknownSession string
+
+func (e errUnknownSession) Error() string { return "unknown session: " + string(e) }
+
+func (r SessionRegistry) Disconnect(addr net.Addr) error {
+	id := SessionId(addr)
+	sess, ok := r[id]
+	if !ok {
+		return errUnknownSession(id)
+	}
+	sess.cleanup()
+	delete(r, id)
+	return nil
+}
+
+func (r SessionRegistry) Find(addr net.Addr) (*Session, bool) {
+	id := SessionId(addr)
+	sess, ok := r[id]
+	return sess, ok
+}
+
+// freeSlot returns the lowest client slot not held by a session.
+func (r SessionRegistry) freeSlot() int {
+	used := make(map[int]bool, len(r))
+	for _, s := range r {
+		used[s.Slot] = true
+	}
+	var slot int
+	for used[slot] {
+		slot++
+	}
+	return slot
+}
+
+// Sorted returns the sessions ordered by client slot.
+func (r SessionRegistry) Sorted() []*Session {
+	out := make([]*Session, 0, len(r))
+	for _, s := range r {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Slot < out[j].Slot })
+	return out
+}
+
+// HalfOpen counts the sessions from which nothing has yet been heard.
+func (r SessionRegistry) HalfOpen() int {
+	var n int
+	for _, s := range r {
+		if s.HalfOpen() {
+			n++
+		}
+	}
+	return n
+}
+
+func (r SessionRegistry) Close() {
+	var wg sync.WaitGroup
+	for _, s := range r {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.cleanup()
+		}()
+	}
+	wg.Wait()
+	for id := range r {
+		delete(r, id)
+	}
+}
+
+func (s *SessionBuf) Add(op instruction) {
+	s.mtx.Lock()
+	s.ops = append(s.ops, op)
+	s.mtx.Unlock()
+}
+
+func (s *SessionBuf) Drain(to []instruction) []instruction {
+	s.mtx.Lock()
+	to = append(to, s.ops...)
+	s.ops = s.ops[:0]
+	s.mtx.Unlock()
+	return to
+}
+
+type Session struct {
+	Cancel        func()
+	Remove        func()
+	Id            string
+	Slot          int
+	LocalAddr     net.Addr
+	LocalPort     int
+	RemoteAddr    net.Addr
+	Conn          net.PacketConn
+	Seq           int
+	Buf           SessionBuf
+	Player        Player
+	Message       Message // reliable commands pending delivery
+	Signon        int
+	Spawned       bool
+	PassedAuth    bool
+	authDeadline  time.Time
+	signonInfo    map[string][]string // name and color given before spawning
+	lastMessage   time.Time           // when the last datagram was received
+	channel       netchan
+	packetsIn     uint64
+	packetsOut    uint64
+	srv           *Server
+	cleanupOnce   sync.Once
+	disconnectSig chan struct{}
+}
+
+func (s *Session) HalfOpen() bool { return atomic.LoadUint64(&s.packetsIn) == 0 }
+
+func (s *Session) Loop(ctx context.Context) error {
+	defer s.cleanup()
+	go func() {
+		if err := s.loopNet(ctx); err != nil {
+			s.srv.log.Println(err)
+		}
+	}()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// loop executes the work received from the network since the last frame.
+// It runs as part of the host frame.
+func (s *Session) loop() error {
+	for _, o := range s.Buf.Drain([]instruction(nil)) {
+		if err := o(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Session) cleanup() {
+	s.cleanupOnce.Do(func() {
+		s.Cancel()
+		if err := s.Conn.Close(); err != nil {
+			s.srv.log.Printf("could not close %v: %v", s.Id, err)
+		}
+		<-s.disconnectSig
+	})
+}
+
+// Drop sends reason and a disconnection to the client before removing the
+// session.
+func (s *Session) Drop(reason string) {
+	var m Message
+	if reason != "" {
+		m.WriteByte(protonetquake.SVCPrint)
+		m.WriteCString(reason)
+	}
+	m.WriteByte(protonetquake.SVCDisconnect)
+	if err := s.SendUnreliable(m.Bytes()); err != nil {
+		s.srv.log.Printf("could not notify %v of disconnection: %v", s.Id, err)
+	}
+	s.Remove()
+}
+
+type instruction func() error
+
+type errInvalidInstruction string
+
+func (e errInvalidInstruction) Error() string { return "invalid instruction: " + string(e) }
+
+const moveSz = 15
+
+// execMsg runs each of the client commands in msg.
+func (s *Session) execMsg(data []byte) error {
+	for len(data) > 0 {
+		switch data[0] {
+		case protonetquake.CLCNop:
+			data = data[1:]
+		case protonetquake.CLCDisconnect:
+			s.Remove()
+			return nil
+		case protonetquake.CLCMove:
+			if len(data) < 1+moveSz {
+				return errInvalidInstruction("short move")
+			}
+			if err := s.Move(data[1 : 1+moveSz]); err != nil {
+				return err
+			}
+			data = data[1+moveSz:]
+		case protonetquake.CLCStringCommand:
+			n := bytes.IndexByte(data[1:], 0)
+			if n == -1 {
+				return errInvalidInstruction("unterminated string command")
+			}
+			if err := s.StringCmd(data[1 : 1+n]); err != nil {
+				return err
+			}
+			data = data[1+n+1:]
+		default:
+			return errInvalidInstruction(fmt.Sprintf("clc %d", data[0]))
+		}
+	}
+	return nil
+}
+
+func (s *Session) Move(data []byte) error {
+	var datum struct {
+		Ping    float32
+		Angle   [3]int8
+		Move    [3]int16 // forward, side, up
+		Button  int8
+		Impulse int8
+	}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &datum); err != nil {
+		return err
+	}
+	s.Player.AddPing(float32(s.srv.Time.Seconds()) - datum.Ping)
+	s.Player.buttons = datum.Button
+	s.srv.countShot(s)
+	return nil
+}
+
+// StringCmd runs the text of a clc_stringcmd.
+func (s *Session) StringCmd(data []byte) error {
+	line := string(data)
+	args := tokenize(line)
+	if len(args) == 0 {
+		return nil
+	}
+	defer s.srv.withArgs(line)()
+	return s.srv.ExecClient(s, args)
+}
+
+const clientDisconnect = 2
+
+var errStaleDatagram = errors.New("stale datagram")
+
+func (s *Session) handleUnreliable(pb *datagram) error {
+	if pb.Before(s.Seq) {
+		s.srv.metrics.datagramsDrop.With("stale").Inc()
+		return errStaleDatagram
+	}
+	if pb.After(s.Seq) {
+		s.srv.metrics.datagramsDrop.With("missed").Add(uint64(pb.Seq() - s.Seq))
+	}
+	s.Seq = pb.Seq() + 1
+	return s.execMsg(pb.Data())
+}
+
+// handleDatagram processes a datagram from the client.  It runs as part of
+// the host frame.
+func (s *Session) handleDatagram(pb *datagram) error {
+	switch {
+	case pb.IsNetCtrl():
+		return nil
+	case pb.IsUnreliable():
+		if err := s.handleUnreliable(pb); err != errStaleDatagram {
+			return err
+		}
+		return nil
+	case pb.flags&protonetquake.NetflagAck != 0:
+		return s.handleAck(pb)
+	case pb.flags&protonetquake.NetflagData != 0:
+		return s.handleReliable(pb)
+	}
+	return nil
+}
+
+func (s *Session) loopNet(ctx context.Context) error {
+	defer close(s.disconnectSig)
+	for {
+		if err := s.loopNetCycle(); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+	}
+}
+
+// loopNetCycle reads one datagram and queues it for the host frame.  The
+// read blocks until a datagram arrives or the session's socket is closed;
+// timeouts are decided on the host frame by timedOut.
+func (s *Session) loopNetCycle() error {
+	var data [protonetquake.MaxDatagram]byte
+	read, err := readDatagram(s.Conn, data[0:0])
+	switch {
+	case err == errShortRead:
+		s.srv.metrics.datagramsDrop.With("short_read").Inc()
+		return nil
+	case err != nil && isErrTransient(err):
+		return nil
+	case err != nil:
+		return err
+	}
+	now := s.srv.clock.Now()
+	atomic.AddUint64(&s.packetsIn, 1)
+	pbuf, err := decodePacketBuf(read)
+	if err != nil {
+		return nil
+	}
+	s.Buf.Add(func() error {
+		s.lastMessage = now
+		return s.handleDatagram(pbuf)
+	})
+	return nil
+}
+
+// timedOut reports whether the client has been silent for longer than
+// net_messagetimeout, or net_connecttimeout before its first datagram, at t.
+func (s *Session) timedOut(t time.Time) bool {
+	timeout := s.srv.cvNetMessageTimeout.Get()
+	if s.HalfOpen() {
+		timeout = s.srv.cvConnectTimeout.Get()
+	}
+	return t.Sub(s.lastMessage) > time.Duration(float64(timeout)*float64(time.Second))
+}
@@ -1,20 +1,24 @@
-package main
+package server
 
 import (
 	"bytes"
 	"errors"
 	"io"
+	"log"
 	"net"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+	"golang.org/x/net/context"
 )
 
 type fakeConn struct {
 	net.PacketConn
-	Closes           []func() error
-	SetReadDeadlines []func(time.Time) error
-	ReadFroms        []func([]byte) (int, net.Addr, error)
+	Closes    []func() error
+	ReadFroms []func([]byte) (int, net.Addr, error)
 }
 
 func (c *fakeConn) Close() error {
@@ -22,11 +26,6 @@ func (c *fakeConn) Close() error {
 	c.Closes = c.Closes[1:]
 	return err
 }
-func (c *fakeConn) SetReadDeadline(t time.Time) error {
-	err := c.SetReadDeadlines[0](t)
-	c.SetReadDeadlines = c.SetReadDeadlines[1:]
-	return err
-}
 func (c *fakeConn) ReadFrom(data []byte) (int, net.Addr, error) {
 	n, addr, err := c.ReadFroms[0](data)
 	c.ReadFroms = c.ReadFroms[1:]
@@ -125,45 +124,148 @@ func TestReadDatagram(t *testing.T) {
 	}
 }
 
-/*
+// pipeConn is an in-memory PacketConn whose reads block until a datagram is
+// delivered or the conn is closed.
+type pipeConn struct {
+	net.PacketConn
+	in        chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+	local     net.Addr
+	remote    net.Addr
+}
+
+func newPipeConn(local, remote net.Addr) *pipeConn {
+	return &pipeConn{
+		in:     make(chan []byte),
+		closed: make(chan struct{}),
+		local:  local,
+		remote: remote,
+	}
+}
+
+func (c *pipeConn) LocalAddr() net.Addr { return c.local }
+func (c *pipeConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+func (c *pipeConn) WriteTo(p []byte, addr net.Addr) (int, error) { return len(p), nil }
+func (c *pipeConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		select {
+		case <-c.closed:
+			return 0, nil, errors.New("use of closed connection")
+		case data := <-c.in:
+			if data == nil {
+				continue
+			}
+			return copy(p, data), c.remote, nil
+		}
+	}
+}
+
+// deliver hands data to the reader and waits for it to be consumed.
+func (c *pipeConn) deliver(data []byte) {
+	c.in <- data
+	c.in <- nil
+}
+
 func TestSession(t *testing.T) {
-	var canceled, removed bool
-	localAddr, err := net.ResolveIPAddr("ip", "127.0.0.1")
+	clock := newFakeClock()
+	local := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 26001}
+	remote := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 27001}
+	var conns []*pipeConn
+	srv, err := New(Config{
+		Clock:   clock,
+		Logger:  log.New(io.Discard, "", 0),
+		Console: io.Discard,
+		ListenSession: func() (net.PacketConn, error) {
+			c := newPipeConn(local, remote)
+			conns = append(conns, c)
+			return c, nil
+		},
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
-	remoteAddr, err := net.ResolveIPAddr("ip", "8.8.8.8")
-	if err != nil {
+	defer srv.Close()
+	nop := []byte{0, 16, 0, 9, 0, 0, 0, 0, 1}
+
+	// A client that never speaks is dropped after net_connecttimeout.
+	if _, err := srv.Sessions.NewSession(context.Background(), srv, remote); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(10 * time.Second)
+	srv.Frame(clock.Now())
+	if got, want := srv.Sessions.Len(), 1; got != want {
+		t.Fatalf("sessions at connect timeout = %v, want = %v", got, want)
+	}
+	clock.Advance(time.Second)
+	srv.Frame(clock.Now())
+	if got, want := srv.Sessions.Len(), 0; got != want {
+		t.Fatalf("sessions after connect timeout = %v, want = %v", got, want)
+	}
+
+	// One that has spoken may stay silent for net_messagetimeout.
+	if _, err := srv.Sessions.NewSession(context.Background(), srv, remote); err != nil {
 		t.Fatal(err)
 	}
-	conn := fakeConn{
-		Closes:           []func() error{func() error { return nil }},
-		SetReadDeadlines: []func(time.Time) error{func(time.Time) error { return nil }},
-		ReadFroms: []func(time.Time) error{func(time.Time) error { return nil }},
+	conns[1].deliver(nop)
+	clock.Advance(time.Minute)
+	srv.Frame(clock.Now())
+	if got, want := srv.Sessions.Len(), 1; got != want {
+		t.Fatalf("sessions after first datagram = %v, want = %v", got, want)
 	}
-	ses := &Session{
-		Cancel:        func() { canceled = true },
-		Remove:        func() { removed = true },
-		Id:            "test-session",
-		LocalAddr:     localAddr,
-		LocalPort:     31337,
-		RemoteAddr:    remoteAddr,
-		Conn:          new(fakeConn),
-		disconnectSig: make(chan struct{}),
+	clock.Advance(4 * time.Minute)
+	conns[1].deliver(nop)
+	srv.Frame(clock.Now())
+	clock.Advance(300 * time.Second)
+	srv.Frame(clock.Now())
+	if got, want := srv.Sessions.Len(), 1; got != want {
+		t.Fatalf("sessions at message timeout = %v, want = %v", got, want)
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	if got, want := ses.Loop(ctx), context.Canceled; got != want {
-		t.Errorf("got = %v, want = %v", got, want)
+	clock.Advance(time.Second)
+	srv.Frame(clock.Now())
+	if got, want := srv.Sessions.Len(), 0; got != want {
+		t.Fatalf("sessions after message timeout = %v, want = %v", got, want)
 	}
-	if got, want := canceled, true; got != want {
-		t.Errorf("got = %v, want = %v", got, want)
+	select {
+	case <-conns[1].closed:
+	default:
+		t.Error("timed out session's socket is open")
+	}
+}
+
+func TestLoopTicks(t *testing.T) {
+	clock := newFakeClock()
+	conn := newPipeConn(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 26000}, nil)
+	srv, err := New(Config{
+		Conn:    conn,
+		Clock:   clock,
+		Logger:  log.New(io.Discard, "", 0),
+		Console: io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Loop(context.Background())
+	defer srv.Close()
+
+	// The first frame runs at once; the next waits for sys_ticrate.
+	clock.blockUntil(1)
+	start := clock.Now()
+	ran := make(chan time.Time, 1)
+	srv.Cbuf.Add(func() { ran <- srv.lastFrame })
+	select {
+	case <-ran:
+		t.Fatal("frame ran before the clock advanced")
+	case <-time.After(10 * time.Millisecond):
 	}
-	if got, want := removed, true; got != want {
-		t.Errorf("got = %v, want = %v", got, want)
+	clock.Advance(50 * time.Millisecond)
+	if got, want := <-ran, start.Add(50*time.Millisecond); !got.Equal(want) {
+		t.Errorf("frame time = %v, want = %v", got, want)
 	}
 }
-*/
 
 func TestDecodeDatagram(t *testing.T) {
 	for _, test := range []struct {
@@ -229,7 +331,7 @@ func TestDatagram(t *testing.T) {
 			dgram: datagram{
 				seq:   1,
 				data:  []byte{},
-				flags: ^(netflagControl | netflagUnreliable),
+				flags: ^(protonetquake.NetflagControl | protonetquake.NetflagUnreliable),
 			},
 			seq:          1,
 			len:          0,
@@ -242,7 +344,7 @@ func TestDatagram(t *testing.T) {
 			dgram: datagram{
 				seq:   2,
 				data:  []byte{1},
-				flags: netflagControl | netflagUnreliable,
+				flags: protonetquake.NetflagControl | protonetquake.NetflagUnreliable,
 			},
 			seq:          2,
 			len:          1,
@@ -255,7 +357,7 @@ func TestDatagram(t *testing.T) {
 			dgram: datagram{
 				seq:   3,
 				data:  []byte{1, 2},
-				flags: ^netflagControl | netflagUnreliable,
+				flags: ^protonetquake.NetflagControl | protonetquake.NetflagUnreliable,
 			},
 			seq:          3,
 			len:          2,
@@ -268,7 +370,7 @@ func TestDatagram(t *testing.T) {
 			dgram: datagram{
 				seq:   4,
 				data:  []byte{1, 2, 3},
-				flags: netflagControl | ^netflagUnreliable,
+				flags: protonetquake.NetflagControl | ^protonetquake.NetflagUnreliable,
 			},
 			seq:          4,
 			len:          3,
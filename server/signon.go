@@ -0,0 +1,160 @@
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"time"
+
+	"github.com/matttproud/go-quake/command"
+	"github.com/matttproud/go-quake/cvar"
+	"github.com/matttproud/go-quake/proto/protonetquake"
+)
+
+// A client joins the game in the stages of host_cmd.c: the server sends its
+// information on connection, after which the client asks to prespawn, spawn
+// and begin in turn.
+
+const passwordTimeout = 30 * time.Second
+
+type signonVars struct {
+	cvPassword *cvar.String
+}
+
+// SendServerInfo queues the first signon message for the client.
+func (s *Session) SendServerInfo(srv *Server) {
+	m := &s.Message
+	m.WriteByte(protonetquake.SVCPrint)
+	m.WriteCString("\x02\nVERSION 1.09 SERVER\n")
+	m.WriteByte(protonetquake.SVCServerInfo)
+	m.WriteLong(protonetquake.ProtocolVersion)
+	m.WriteByte(byte(srv.MaxPlayers))
+	if s.srv.cvCoop.Get() == 0 && s.srv.cvDeathmatch.Get() != 0 {
+		m.WriteByte(protonetquake.GameDeathmatch)
+	} else {
+		m.WriteByte(protonetquake.GameCoop)
+	}
+	m.WriteCString(srv.Map)
+	if srv.Map != "" {
+		m.WriteCString("maps/" + srv.Map + ".bsp")
+	}
+	m.WriteByte(0) // end of models
+	m.WriteByte(0) // end of sounds
+	m.WriteByte(protonetquake.SVCCDTrack)
+	m.WriteByte(0)
+	m.WriteByte(0)
+	m.WriteByte(protonetquake.SVCSetView)
+	m.WriteShort(int16(s.Slot + 1))
+	m.WriteByte(protonetquake.SVCSignOnNum)
+	m.WriteByte(1)
+	s.Signon = 1
+	s.Spawned = false
+	if s.srv.cvPassword.Get() != "" {
+		s.Printf("This server requires a password; use \"cmd pass <password>\".\n")
+	}
+}
+
+// Printf queues text for display on the client's console through Sprint.
+func (s *Session) Printf(format string, args ...interface{}) {
+	s.srv.Sprint(s, fmt.Sprintf(format, args...))
+}
+
+// print sends text to the client without the scrutiny of Sprint.
+func (s *Session) print(text string) {
+	s.Message.WriteByte(protonetquake.SVCPrint)
+	s.Message.WriteCString(text)
+}
+
+func (s *Session) cmdPass(args ...string) error {
+	if len(args) != 1 {
+		s.Printf("usage: pass <password>\n")
+		return nil
+	}
+	want := s.srv.cvPassword.Get()
+	if want == "" || s.PassedAuth {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(args[0]), []byte(want)) != 1 {
+		s.Drop("Incorrect password.\n")
+		return nil
+	}
+	s.PassedAuth = true
+	s.Printf("Password accepted.\n")
+	if s.authDeadline.IsZero() {
+		return nil
+	}
+	s.authDeadline = time.Time{}
+	return s.cmdSpawn()
+}
+
+// AuthExpired reports whether the client has held its spawn for a password
+// for too long.
+func (s *Session) AuthExpired(now time.Time) bool {
+	return !s.authDeadline.IsZero() && now.After(s.authDeadline)
+}
+
+func (s *Session) cmdPrespawn(args ...string) error {
+	if s.Spawned {
+		s.Printf("prespawn not valid -- already spawned\n")
+		return nil
+	}
+	s.Message.WriteByte(protonetquake.SVCSignOnNum)
+	s.Message.WriteByte(2)
+	s.Signon = 2
+	return nil
+}
+
+func (s *Session) cmdSpawn(args ...string) error {
+	if s.Spawned {
+		s.Printf("Spawn not valid -- already spawned\n")
+		return nil
+	}
+	if s.srv.cvPassword.Get() == "" {
+		s.PassedAuth = true
+	}
+	if !s.PassedAuth {
+		// Hold the client here until it supplies the password.
+		if s.authDeadline.IsZero() {
+			s.authDeadline = s.srv.clock.Now().Add(passwordTimeout)
+		}
+		return nil
+	}
+	s.srv.spawnEdict(s)
+	s.Message.WriteByte(protonetquake.SVCTime)
+	s.Message.WriteFloat(float32(s.srv.Time.Seconds()))
+	// Send the names, colors and frags of everyone in the game.
+	for _, sess := range s.srv.Sessions.Sorted() {
+		sess.updateName(&s.Message)
+		sess.updateFrags(&s.Message)
+		sess.updateColors(&s.Message)
+	}
+	s.Message.WriteByte(protonetquake.SVCSignOnNum)
+	s.Message.WriteByte(3)
+	s.Signon = 3
+	return nil
+}
+
+func (s *Session) cmdBegin(args ...string) error {
+	if s.Signon != 3 {
+		s.Printf("begin not valid -- not spawned\n")
+		return nil
+	}
+	s.Spawned = true
+	info := s.signonInfo
+	s.signonInfo = nil
+	for _, name := range signonInfo {
+		if args, ok := info[name]; ok {
+			s.srv.ExecClient(s, args)
+		}
+	}
+	return nil
+}
+
+func (s *Server) initSignon() {
+	s.addCommand("pass", s.clientCmd("pass", (*Session).cmdPass), command.ClientCallable)
+	s.addCommand("prespawn", s.clientCmd("prespawn", (*Session).cmdPrespawn), command.ClientCallable)
+	s.addCommand("spawn", s.clientCmd("spawn", (*Session).cmdSpawn), command.ClientCallable)
+	s.addCommand("begin", s.clientCmd("begin", (*Session).cmdBegin), command.ClientCallable)
+
+	// The password is not server-side lest rule queries reveal it.
+	s.cvPassword = s.newString("sv_password", "", cvar.Secret)
+}
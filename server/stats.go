@@ -0,0 +1,321 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/matttproud/go-quake/command"
+)
+
+// Statistics accumulate across matches by player name and are kept in a
+// JSON file in the game directory.
+
+const statsFile = "stats.json"
+
+type WeaponStats struct {
+	Shots int `json:"shots"`
+	Hits  int `json:"hits"`
+}
+
+// Accuracy is the fraction of shots that hit.
+func (w *WeaponStats) Accuracy() float64 {
+	if w.Shots == 0 {
+		return 0
+	}
+	return float64(w.Hits) / float64(w.Shots)
+}
+
+type PlayerStats struct {
+	Name      string                  `json:"name"`
+	Frags     int                     `json:"frags"`
+	Deaths    int                     `json:"deaths"`
+	Suicides  int                     `json:"suicides"`
+	TeamKills int                     `json:"team_kills"`
+	Wins      int                     `json:"wins"`
+	PlayTime  time.Duration           `json:"play_time"`
+	Weapons   map[string]*WeaponStats `json:"weapons,omitempty"`
+	LastSeen  time.Time               `json:"last_seen"`
+}
+
+// StatsStore holds the statistics.  One without a path, as a server without
+// a game directory has, is kept only in memory.
+type StatsStore struct {
+	Players map[string]*PlayerStats `json:"players"`
+	path    string
+}
+
+type errUnknownPlayer string
+
+func (e errUnknownPlayer) Error() string { return "no statistics for " + string(e) }
+
+func newStatsStore(path string) *StatsStore {
+	return &StatsStore{Players: make(map[string]*PlayerStats), path: path}
+}
+
+// LoadStats reads the store from path, which needn't exist yet.
+func LoadStats(path string) (*StatsStore, error) {
+	st := newStatsStore(path)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(st); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if st.Players == nil {
+		st.Players = make(map[string]*PlayerStats)
+	}
+	return st, nil
+}
+
+// Save writes the store back to the file from which it was loaded.
+func (st *StatsStore) Save() error {
+	if st.path == "" {
+		return nil
+	}
+	tmp := st.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(st); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.path)
+}
+
+func (st *StatsStore) player(name string) *PlayerStats {
+	p, ok := st.Players[name]
+	if !ok {
+		p = &PlayerStats{Name: name}
+		st.Players[name] = p
+	}
+	return p
+}
+
+// Lookup finds a player's statistics irrespective of case.
+func (st *StatsStore) Lookup(name string) (*PlayerStats, bool) {
+	if p, ok := st.Players[name]; ok {
+		return p, true
+	}
+	for n, p := range st.Players {
+		if strings.EqualFold(n, name) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Record counts the game event.
+func (st *StatsStore) Record(ev *GameEvent) {
+	if ev.Player == nil {
+		return
+	}
+	p := st.player(ev.Player.Name)
+	p.LastSeen = ev.Wall
+	switch ev.Type {
+	case "frag":
+		p.Frags++
+		if ev.Target != nil {
+			st.player(ev.Target.Name).Deaths++
+		}
+	case "suicide":
+		p.Suicides++
+		p.Deaths++
+	case "teamkill":
+		p.TeamKills++
+	case "win":
+		p.Wins++
+	}
+}
+
+// weapon returns the player's statistics for the named weapon.
+func (p *PlayerStats) weapon(name string) *WeaponStats {
+	if p.Weapons == nil {
+		p.Weapons = make(map[string]*WeaponStats)
+	}
+	w, ok := p.Weapons[name]
+	if !ok {
+		w = new(WeaponStats)
+		p.Weapons[name] = w
+	}
+	return w
+}
+
+// RecordShot counts a shot by the named player with weapon.
+func (st *StatsStore) RecordShot(name, weapon string) { st.player(name).weapon(weapon).Shots++ }
+
+// RecordHit counts a shot by the named player with weapon that hit.
+func (st *StatsStore) RecordHit(name, weapon string) { st.player(name).weapon(weapon).Hits++ }
+
+// weapons name the player's weapons by their item bit and give the delay
+// between their shots in W_Attack, or between nails and bolts for those that
+// fire continuously.
+var weapons = map[int]struct {
+	name   string
+	refire time.Duration
+}{
+	itemAxe:             {"axe", 500 * time.Millisecond},
+	itemShotgun:         {"shotgun", 500 * time.Millisecond},
+	itemSuperShotgun:    {"super_shotgun", 700 * time.Millisecond},
+	itemNailgun:         {"nailgun", 100 * time.Millisecond},
+	itemSuperNailgun:    {"super_nailgun", 100 * time.Millisecond},
+	itemGrenadeLauncher: {"grenade_launcher", 600 * time.Millisecond},
+	itemRocketLauncher:  {"rocket_launcher", 800 * time.Millisecond},
+	itemLightning:       {"lightning", 100 * time.Millisecond},
+}
+
+// countShot counts a shot by the client if it holds the attack button and
+// its weapon is ready to fire again.
+func (s *Server) countShot(sess *Session) {
+	if !sess.Spawned || sess.Player.buttons&1 == 0 || s.Paused || s.intermission.running {
+		return
+	}
+	e := s.clientEdict(sess)
+	if e == nil {
+		return
+	}
+	w, ok := weapons[int(e.V.Weapon)]
+	if !ok || s.Time < sess.Player.nextShot {
+		return
+	}
+	sess.Player.nextShot = s.Time + w.refire
+	sess.Player.shotHit = false
+	if named(sess) {
+		s.Stats.RecordShot(sess.Player.Name, w.name)
+	}
+}
+
+// countHit counts the attacker's last shot as a hit if the attacker is a
+// client and the shot has not hit already.
+func (s *Server) countHit(target, attacker *Edict) {
+	if target == attacker {
+		return
+	}
+	sess := s.edictSession(attacker)
+	if sess == nil || sess.Player.shotHit || !named(sess) {
+		return
+	}
+	if w, ok := weapons[int(attacker.V.Weapon)]; ok {
+		sess.Player.shotHit = true
+		s.Stats.RecordHit(sess.Player.Name, w.name)
+	}
+}
+
+// named reports whether the client has given a name under which to keep its
+// statistics.
+func named(sess *Session) bool {
+	return sess.Player.Name != "" && sess.Player.Name != "unconnected"
+}
+
+// AddPlayTime credits the player with the time since it connected or last
+// was credited.  Time spent without a name is credited to no one.
+func (st *StatsStore) AddPlayTime(sess *Session, now time.Time) {
+	since := sess.Player.ConnectTime
+	if sess.Player.creditedTime.After(since) {
+		since = sess.Player.creditedTime
+	}
+	if named(sess) {
+		st.player(sess.Player.Name).PlayTime += now.Sub(since)
+	}
+	sess.Player.creditedTime = now
+}
+
+// saveStats credits everyone in the game with their play time and saves the
+// store.
+func (s *Server) saveStats() {
+	now := s.clock.Now()
+	for _, sess := range s.Sessions {
+		if sess.Spawned {
+			s.Stats.AddPlayTime(sess, now)
+		}
+	}
+	if err := s.Stats.Save(); err != nil {
+		s.log.Printf("Saving statistics: %v", err)
+	}
+}
+
+func (s *Server) cmdStats(args ...string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: stats <name>")
+	}
+	p, ok := s.Stats.Lookup(args[0])
+	if !ok {
+		return errUnknownPlayer(args[0])
+	}
+	s.conPrintf("%s\n", p.Name)
+	s.conPrintf("frags:     %d\n", p.Frags)
+	s.conPrintf("deaths:    %d\n", p.Deaths)
+	s.conPrintf("suicides:  %d\n", p.Suicides)
+	s.conPrintf("teamkills: %d\n", p.TeamKills)
+	s.conPrintf("wins:      %d\n", p.Wins)
+	s.conPrintf("playtime:  %v\n", p.PlayTime.Truncate(time.Second))
+	weapons := make([]string, 0, len(p.Weapons))
+	for w := range p.Weapons {
+		weapons = append(weapons, w)
+	}
+	sort.Strings(weapons)
+	for _, w := range weapons {
+		s.conPrintf("%-17s %3.0f%% of %d\n", w+":", 100*p.Weapons[w].Accuracy(), p.Weapons[w].Shots)
+	}
+	return nil
+}
+
+func (s *Server) handleAPIStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/api/stats/")
+	if name == r.URL.Path {
+		name = ""
+	}
+	var (
+		out  interface{}
+		lerr error
+	)
+	err := s.onFrame(func() {
+		if name == "" {
+			players := make([]PlayerStats, 0, len(s.Stats.Players))
+			for _, p := range s.Stats.Players {
+				players = append(players, *p)
+			}
+			sort.Slice(players, func(i, j int) bool { return players[i].Name < players[j].Name })
+			out = players
+			return
+		}
+		p, ok := s.Stats.Lookup(name)
+		if !ok {
+			lerr = errUnknownPlayer(name)
+			return
+		}
+		out = *p
+	})
+	switch {
+	case err != nil:
+		writeAPIError(w, http.StatusServiceUnavailable, err)
+	case lerr != nil:
+		writeAPIError(w, apiErrorCode(lerr), lerr)
+	default:
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+func (s *Server) initStats() {
+	s.addCommand("stats", s.cmdStats, command.ClientCallable)
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStatsStore(t *testing.T) {
+	srv := newTestServer(t)
+	path := filepath.Join(t.TempDir(), statsFile)
+	st, err := LoadStats(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, bob := &eventPlayer{Name: "alice"}, &eventPlayer{Name: "bob"}
+	for _, ev := range []GameEvent{
+		{Type: "frag", Player: alice, Target: bob},
+		{Type: "frag", Player: alice, Target: bob},
+		{Type: "frag", Player: bob, Target: alice},
+		{Type: "suicide", Player: bob},
+		{Type: "teamkill", Player: alice},
+		{Type: "win", Player: alice},
+		{Type: "say", Player: bob},
+	} {
+		st.Record(&ev)
+	}
+	st.RecordShot("alice", "rocket_launcher")
+	st.RecordShot("alice", "rocket_launcher")
+	st.RecordHit("alice", "rocket_launcher")
+	sess, _ := newTestSession(srv, nil)
+	sess.Player = Player{Name: "bob", ConnectTime: time.Unix(0, 0)}
+	st.AddPlayTime(sess, time.Unix(60, 0))
+	st.AddPlayTime(sess, time.Unix(90, 0))
+	if err := st.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if st, err = LoadStats(path); err != nil {
+		t.Fatal(err)
+	}
+	a, ok := st.Lookup("ALICE")
+	if !ok {
+		t.Fatal("alice not found")
+	}
+	if a.Frags != 2 || a.Deaths != 1 || a.TeamKills != 1 || a.Wins != 1 {
+		t.Errorf("alice = %+v", a)
+	}
+	if got, want := a.Weapons["rocket_launcher"].Accuracy(), .5; got != want {
+		t.Errorf("rocket accuracy = %v, want = %v", got, want)
+	}
+	b, _ := st.Lookup("bob")
+	if b.Frags != 1 || b.Deaths != 3 || b.Suicides != 1 {
+		t.Errorf("bob = %+v", b)
+	}
+	if got, want := b.PlayTime, 90*time.Second; got != want {
+		t.Errorf("bob's play time = %v, want = %v", got, want)
+	}
+	if _, ok := st.Lookup("carol"); ok {
+		t.Error("found carol")
+	}
+}
+
+// TestStatsWithoutGameDir checks that a server without a game directory
+// keeps its statistics in memory.
+func TestStatsWithoutGameDir(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Stats.Record(&GameEvent{Type: "frag", Player: &eventPlayer{Name: "alice"}})
+	if err := srv.cmdStats("alice"); err != nil {
+		t.Error(err)
+	}
+	if err := srv.cmdStats("bob"); err == nil {
+		t.Error("stats bob succeeded")
+	}
+
+	defer runFrames(srv)()
+	for _, test := range []struct {
+		name string
+		code int
+	}{
+		{"alice", http.StatusOK},
+		{"bob", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		srv.handleAPIStats(w, httptest.NewRequest("GET", "/api/stats/"+test.name, nil))
+		if got, want := w.Code, test.code; got != want {
+			t.Errorf("GET %s: got = %v, want = %v", test.name, got, want)
+		}
+	}
+	w := httptest.NewRecorder()
+	srv.handleAPIStats(w, httptest.NewRequest("GET", "/api/stats/", nil))
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("GET all: got = %v, want = %v", got, want)
+	}
+}
+
+func TestStatsPlayerNames(t *testing.T) {
+	clock := newFakeClock()
+	srv, err := New(Config{Logger: log.New(io.Discard, "", 0), Console: io.Discard, Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, _ := newTestSession(srv, &recordingConn{})
+	sess.Player = Player{Name: "unconnected", ConnectTime: clock.Now()}
+	srv.Sessions[sess.Id] = sess
+	srv.logEvent("connect", sess, nil, "")
+	if _, ok := srv.Stats.Lookup("unconnected"); ok {
+		t.Error("recorded statistics for an unnamed client")
+	}
+
+	sess.Spawned = true
+	sess.PassedAuth = true
+	clock.Advance(10 * time.Second)
+	srv.ExecClient(sess, []string{"name", "alice"})
+	clock.Advance(60 * time.Second)
+	srv.ExecClient(sess, []string{"name", "bob"})
+	clock.Advance(30 * time.Second)
+	srv.saveStats()
+	for _, test := range []struct {
+		name string
+		want time.Duration
+	}{
+		{"alice", 60 * time.Second},
+		{"bob", 30 * time.Second},
+	} {
+		p, ok := srv.Stats.Lookup(test.name)
+		if !ok {
+			t.Errorf("no statistics for %s", test.name)
+			continue
+		}
+		if got := p.PlayTime; got != test.want {
+			t.Errorf("%s: play time = %v, want = %v", test.name, got, test.want)
+		}
+	}
+	if _, ok := srv.Stats.Lookup("unconnected"); ok {
+		t.Error("credited play time to an unnamed client")
+	}
+}
+
+func TestShotAccuracy(t *testing.T) {
+	srv := newTestServer(t)
+	var players []*Session
+	for i, name := range []string{"alice", "bob"} {
+		sess, _ := newTestSession(srv, &recordingConn{})
+		sess.Id = name
+		sess.Slot = i
+		sess.Player.Name = name
+		srv.Sessions[name] = sess
+		for _, cmd := range []string{"prespawn", "spawn", "begin"} {
+			srv.ExecClient(sess, []string{cmd})
+		}
+		players = append(players, sess)
+	}
+	attack := make([]byte, moveSz)
+	attack[13] = 1
+	for _, d := range []time.Duration{0, 100 * time.Millisecond, 600 * time.Millisecond} {
+		srv.Time = d
+		if err := players[0].Move(attack); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice, bob := srv.clientEdict(players[0]), srv.clientEdict(players[1])
+	srv.damage(bob, alice, 4)
+	srv.damage(bob, alice, 4)
+
+	p, ok := srv.Stats.Lookup("alice")
+	if !ok {
+		t.Fatal("no statistics for alice")
+	}
+	if got, want := *p.Weapons["shotgun"], (WeaponStats{Shots: 2, Hits: 1}); got != want {
+		t.Errorf("shotgun = %+v, want = %+v", got, want)
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"log"
+	"net"
+	"time"
+
+	"github.com/matttproud/go-quake/cvar"
+)
+
+type throttleVars struct {
+	cvCtrlRate       *cvar.Float
+	cvCtrlBurst      *cvar.Float
+	cvCtrlStrikes    *cvar.Float
+	cvCtrlBanTime    *cvar.Float
+	cvMaxHalfOpen    *cvar.Float
+	cvConnectTimeout *cvar.Float
+}
+
+// ctrlThrottle limits the rate at which each source address may send control
+// packets and temporarily bans those that repeatedly send invalid requests.
+type ctrlThrottle struct {
+	clients   map[string]*ctrlClient
+	lastSweep time.Time
+	vars      *throttleVars
+	dropped   *counterVec
+	log       *log.Logger
+}
+
+type ctrlClient struct {
+	tokens  float64
+	last    time.Time
+	strikes int
+	banned  time.Time // until
+}
+
+// hostKey identifies the source host of addr irrespective of its port.
+func hostKey(addr net.Addr) string {
+	if u, ok := addr.(*net.UDPAddr); ok {
+		return u.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+func (t *ctrlThrottle) client(addr net.Addr, now time.Time) *ctrlClient {
+	if t.clients == nil {
+		t.clients = make(map[string]*ctrlClient)
+	}
+	k := hostKey(addr)
+	c, ok := t.clients[k]
+	if !ok {
+		c = &ctrlClient{tokens: float64(t.vars.cvCtrlBurst.Get()), last: now}
+		t.clients[k] = c
+	}
+	return c
+}
+
+// Allow reports whether a control packet from addr may be processed.
+func (t *ctrlThrottle) Allow(addr net.Addr, now time.Time) bool {
+	c := t.client(addr, now)
+	if now.Before(c.banned) {
+		t.dropped.With("banned").Inc()
+		return false
+	}
+	c.tokens += now.Sub(c.last).Seconds() * float64(t.vars.cvCtrlRate.Get())
+	if burst := float64(t.vars.cvCtrlBurst.Get()); c.tokens > burst {
+		c.tokens = burst
+	}
+	c.last = now
+	if c.tokens < 1 {
+		t.dropped.With("rate").Inc()
+		return false
+	}
+	c.tokens--
+	return true
+}
+
+// Strike records an invalid request from addr, banning it once it has
+// exhausted its allowance.
+func (t *ctrlThrottle) Strike(addr net.Addr, now time.Time) {
+	c := t.client(addr, now)
+	c.strikes++
+	if c.strikes < int(t.vars.cvCtrlStrikes.Get()) {
+		return
+	}
+	c.strikes = 0
+	c.banned = now.Add(time.Duration(t.vars.cvCtrlBanTime.Get()) * time.Second)
+	t.log.Printf("Banning %s from the control socket until %v", hostKey(addr), c.banned)
+}
+
+// Sweep forgets the addresses that are not banned and have been idle long
+// enough to regain their full allowance.
+func (t *ctrlThrottle) Sweep(now time.Time) {
+	const sweepInterval = 10 * time.Second
+	if now.Sub(t.lastSweep) < sweepInterval {
+		return
+	}
+	t.lastSweep = now
+	for k, c := range t.clients {
+		idle := now.Sub(c.last).Seconds() * float64(t.vars.cvCtrlRate.Get())
+		if now.After(c.banned) && c.tokens+idle >= float64(t.vars.cvCtrlBurst.Get()) {
+			delete(t.clients, k)
+		}
+	}
+}
+
+func (s *Server) initThrottle() {
+	s.cvCtrlRate = s.newFloat("net_ctrlrate", 5)
+	s.cvCtrlBurst = s.newFloat("net_ctrlburst", 20)
+	s.cvCtrlStrikes = s.newFloat("net_ctrlstrikes", 10)
+	s.cvCtrlBanTime = s.newFloat("net_ctrlbantime", 60)
+	s.cvMaxHalfOpen = s.newFloat("net_maxhalfopen", 4)
+	s.cvConnectTimeout = s.newFloat("net_connecttimeout", 10)
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCtrlThrottle(t *testing.T) {
+	srv := newTestServer(t)
+	srv.cvCtrlRate.Set(1)
+	srv.cvCtrlBurst.Set(2)
+	srv.cvCtrlStrikes.Set(2)
+	srv.cvCtrlBanTime.Set(60)
+
+	var (
+		th    = &srv.throttle
+		start = time.Unix(0, 0)
+		a     = &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}
+		aPort = &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 2000}
+		b     = &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 1000}
+	)
+	for i, step := range []struct {
+		addr   net.Addr
+		at     time.Duration
+		strike bool
+		allow  bool
+	}{
+		{addr: a, at: 0, allow: true},
+		{addr: aPort, at: 0, allow: true},
+		{addr: a, at: 0, allow: false},
+		{addr: b, at: 0, allow: true},
+		{addr: a, at: time.Second, allow: true},
+		{addr: a, at: time.Second, allow: false},
+		{addr: b, at: 2 * time.Second, strike: true},
+		{addr: b, at: 2 * time.Second, strike: true},
+		{addr: b, at: 10 * time.Second, allow: false},
+		{addr: a, at: 10 * time.Second, allow: true},
+		{addr: b, at: 63 * time.Second, allow: true},
+	} {
+		now := start.Add(step.at)
+		if step.strike {
+			th.Strike(step.addr, now)
+			continue
+		}
+		if got, want := th.Allow(step.addr, now), step.allow; got != want {
+			t.Errorf("%d. Allow(%v) = %v, want = %v", i, step.addr, got, want)
+		}
+	}
+	th.lastSweep = start
+	th.Sweep(start.Add(time.Hour))
+	if got, want := len(th.clients), 0; got != want {
+		t.Errorf("got = %v, want = %v", got, want)
+	}
+}
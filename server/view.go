@@ -0,0 +1,43 @@
+package server
+
+import "github.com/matttproud/go-quake/cvar"
+
+func (s *Server) initView() {
+	s.addCommand("v_cshift", noImpl)
+	s.addCommand("bf", noImpl)
+	s.addCommand("centerview", noImpl)
+
+	s.newFloat("lcd_x", 0)
+	s.newFloat("lcd_yaw", 0)
+
+	s.newFloat("scr_ofsx", 0)
+	s.newFloat("scr_ofsy", 0)
+	s.newFloat("scr_ofsz", 0)
+
+	s.newFloat("cl_rollspeed", 200)
+	s.newFloat("cl_rollangle", 2.0)
+
+	s.newFloat("cl_bob", 0.02)
+	s.newFloat("cl_bobup", 0.5)
+
+	s.newFloat("v_kicktime", 0.5)
+	s.newFloat("v_kickroll", 0.5)
+	s.newFloat("v_kickpitch", 0.5)
+
+	s.newFloat("v_iyaw_cycle", 2)
+	s.newFloat("v_iroll_cycle", 0.5)
+	s.newFloat("v_ipitch_cycle", 1)
+	s.newFloat("v_iyaw_level", 0.3)
+	s.newFloat("v_iroll_level", 0.1)
+	s.newFloat("v_ipitch_level", 0.3)
+
+	s.newFloat("v_idlescale", 0)
+
+	s.newFloat("crosshair", 0, cvar.Saved)
+	s.newFloat("cl_crossx", 0)
+	s.newFloat("cl_crossy", 0)
+
+	s.newFloat("gl_cshiftpercent", 100)
+
+	s.newFloat("gamma", 1, cvar.Saved)
+}
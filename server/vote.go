@@ -0,0 +1,151 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/matttproud/go-quake/command"
+	"github.com/matttproud/go-quake/cvar"
+)
+
+// Players may vote to change the map.  A vote passes once more than
+// sv_vote_threshold of the spawned players agree and fails once that is no
+// longer possible or sv_vote_timeout passes.  Each player may call a vote
+// once every sv_vote_cooldown seconds.
+
+type voteVars struct {
+	cvVoteThreshold *cvar.Float
+	cvVoteTimeout   *cvar.Float
+	cvVoteCooldown  *cvar.Float
+}
+
+type vote struct {
+	desc    string
+	mapname string
+	expires time.Time
+	ballots map[string]bool // by session
+}
+
+func validMapName(name string) bool {
+	if name == "" || len(name) > 32 {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func inRotation(maps []string, name string) bool {
+	for _, m := range maps {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CallVote begins a vote by sess to change to mapname.
+func (s *Server) CallVote(sess *Session, desc, mapname string, now time.Time) {
+	if s.vote != nil {
+		sess.Printf("A vote is already in progress.\n")
+		return
+	}
+	cooldown := seconds(s.cvVoteCooldown.Get())
+	if wait := cooldown - now.Sub(sess.Player.lastVote); !sess.Player.lastVote.IsZero() && wait > 0 {
+		sess.Printf("You must wait %d seconds to call another vote.\n", int(wait.Seconds()+.5))
+		return
+	}
+	sess.Player.lastVote = now
+	s.vote = &vote{
+		desc:    desc,
+		mapname: mapname,
+		expires: now.Add(seconds(s.cvVoteTimeout.Get())),
+		ballots: map[string]bool{sess.Id: true},
+	}
+	s.CenterPrintf("%s called a vote:\n%s\n\nvote yes or vote no", sess.Player.Name, desc)
+	s.BroadcastPrintf("%s called a vote: %s\n", sess.Player.Name, desc)
+	s.runVote(now)
+}
+
+// Ballot records the vote of sess.
+func (s *Server) Ballot(sess *Session, yes bool, now time.Time) {
+	if s.vote == nil {
+		sess.Printf("No vote is in progress.\n")
+		return
+	}
+	s.vote.ballots[sess.Id] = yes
+	s.runVote(now)
+}
+
+// runVote decides the vote in progress once its outcome is certain.
+func (s *Server) runVote(now time.Time) {
+	v := s.vote
+	if v == nil {
+		return
+	}
+	var players, yes, no int
+	for _, sess := range s.Sessions {
+		if !sess.Spawned {
+			continue
+		}
+		players++
+		if b, ok := v.ballots[sess.Id]; ok && b {
+			yes++
+		} else if ok {
+			no++
+		}
+	}
+	need := s.cvVoteThreshold.Get() * float32(players)
+	switch {
+	case float32(yes) > need:
+		s.vote = nil
+		s.CenterPrintf("Vote passed:\n%s", v.desc)
+		s.BroadcastPrintf("Vote passed: %s\n", v.desc)
+		s.AddText("changelevel " + v.mapname)
+	case float32(players-no) <= need, !now.Before(v.expires):
+		s.vote = nil
+		s.CenterPrintf("Vote failed:\n%s", v.desc)
+		s.BroadcastPrintf("Vote failed: %s\n", v.desc)
+	}
+}
+
+func cmdVote(s *Session, args ...string) error {
+	now := s.srv.clock.Now()
+	if len(args) == 0 {
+		return fmt.Errorf("usage: vote map <name> | vote next | vote yes | vote no")
+	}
+	switch args[0] {
+	case "yes", "no":
+		s.srv.Ballot(s, args[0] == "yes", now)
+	case "map":
+		if len(args) != 2 || !validMapName(args[1]) {
+			return fmt.Errorf("usage: vote map <name>")
+		}
+		if maps := s.srv.rotation(); len(maps) > 0 && !inRotation(maps, args[1]) {
+			return fmt.Errorf("%s is not in the map list", args[1])
+		}
+		s.srv.CallVote(s, "map "+args[1], args[1], now)
+	case "next":
+		next := s.srv.nextInRotation()
+		if next == "" {
+			return fmt.Errorf("there is no map rotation")
+		}
+		s.srv.CallVote(s, "next map ("+next+")", next, now)
+	default:
+		return fmt.Errorf("usage: vote map <name> | vote next | vote yes | vote no")
+	}
+	return nil
+}
+
+func (s *Server) initVote() {
+	s.addCommand("vote", s.clientCmd("vote", cmdVote), command.ClientCallable)
+
+	s.cvVoteThreshold = s.newFloat("sv_vote_threshold", 0.5)
+	s.cvVoteTimeout = s.newFloat("sv_vote_timeout", 30)
+	s.cvVoteCooldown = s.newFloat("sv_vote_cooldown", 60)
+}
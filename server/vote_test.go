@@ -0,0 +1,83 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVote(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Map = "dm2"
+	srv.MapList = []string{"dm2", "dm4", "dm6"}
+	var players []*Session
+	for _, id := range []string{"a", "b", "c"} {
+		sess, _ := newTestSession(srv, &recordingConn{})
+		sess.Id = id
+		sess.Spawned = true
+		sess.PassedAuth = true
+		srv.Sessions[id] = sess
+		players = append(players, sess)
+	}
+	now := time.Unix(100, 0)
+
+	if got, want := srv.nextInRotation(), "dm4"; got != want {
+		t.Errorf("srv.nextInRotation() = %q, want = %q", got, want)
+	}
+
+	// Rejected by the others.
+	srv.CallVote(players[0], "map dm6", "dm6", now)
+	srv.Ballot(players[1], false, now)
+	if srv.vote == nil {
+		t.Fatal("vote ended early")
+	}
+	srv.Ballot(players[2], false, now)
+	if srv.vote != nil {
+		t.Fatal("vote did not fail")
+	}
+
+	// Too soon to call another.
+	srv.CallVote(players[0], "next map (dm4)", "dm4", now.Add(time.Second))
+	if srv.vote != nil {
+		t.Fatal("vote called during cooldown")
+	}
+
+	// Timed out.
+	srv.CallVote(players[1], "next map (dm4)", "dm4", now)
+	srv.runVote(now.Add(29 * time.Second))
+	if srv.vote == nil {
+		t.Fatal("vote ended early")
+	}
+	srv.runVote(now.Add(30 * time.Second))
+	if srv.vote != nil {
+		t.Fatal("vote did not time out")
+	}
+
+	// Passed.
+	srv.CallVote(players[2], "next map (dm4)", "dm4", now)
+	srv.Ballot(players[0], true, now)
+	if srv.vote != nil {
+		t.Fatal("vote did not pass")
+	}
+	srv.Cbuf.Execute()
+	if got, want := srv.Map, "dm4"; got != want {
+		t.Errorf("srv.Map = %q, want = %q", got, want)
+	}
+}
+
+func TestValidMapName(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		want bool
+	}{
+		{"dm4", true},
+		{"e1m1", true},
+		{"my_map-2", true},
+		{"", false},
+		{"dm4;quit", false},
+		{"../dm4", false},
+	} {
+		if got := validMapName(test.name); got != test.want {
+			t.Errorf("validMapName(%q) = %v, want = %v", test.name, got, test.want)
+		}
+	}
+}
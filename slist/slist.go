@@ -0,0 +1,137 @@
+// Package slist queries NetQuake servers for their status, either by
+// broadcasting on the local network or by asking a list of hosts.
+package slist
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+)
+
+// DefaultPort is the port on which stock servers listen.
+const DefaultPort = protonetquake.StockPort
+
+// Server is a server's answer to a server info query.
+type Server struct {
+	Addr       net.Addr // from which the reply was received
+	Address    string   // as reported by the server
+	Hostname   string
+	Map        string
+	Players    int
+	MaxPlayers int
+	Protocol   int
+}
+
+// Broadcast is the local network broadcast address for servers on port.
+func Broadcast(port int) net.Addr {
+	return &net.UDPAddr{IP: net.IPv4bcast, Port: port}
+}
+
+// Resolve resolves host, which may omit the port, to the address of a server.
+func Resolve(host string, port int) (net.Addr, error) {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, fmt.Sprint(port))
+	}
+	return net.ResolveUDPAddr("udp", host)
+}
+
+// Request encodes a CCREQ_SERVER_INFO query.
+func Request() []byte {
+	payload := append([]byte("QUAKE\x00"), protonetquake.NetProtocolVersion)
+	return protonetquake.CtrlPacket(protonetquake.CCReqServerInfo, payload)
+}
+
+type ErrBadReply string
+
+func (e ErrBadReply) Error() string { return "slist: bad reply: " + string(e) }
+
+// ParseReply decodes a CCREP_SERVER_INFO reply.
+func ParseReply(data []byte) (*Server, error) {
+	if len(data) < protonetquake.CtrlHeaderSize {
+		return nil, ErrBadReply("too short")
+	}
+	cmd, payload, ok := protonetquake.ParseCtrl(data)
+	if !ok {
+		return nil, ErrBadReply("not a control packet")
+	}
+	if cmd != protonetquake.CCRepServerInfo {
+		return nil, ErrBadReply(fmt.Sprintf("unexpected command %#x", cmd))
+	}
+	r := bytes.NewBuffer(payload)
+	var (
+		srv  Server
+		nums [3]byte
+	)
+	for _, s := range []*string{&srv.Address, &srv.Hostname, &srv.Map} {
+		v, err := r.ReadString(0)
+		if err != nil {
+			return nil, ErrBadReply("truncated string")
+		}
+		*s = v[:len(v)-1]
+	}
+	if _, err := io.ReadFull(r, nums[:]); err != nil {
+		return nil, ErrBadReply("truncated counts")
+	}
+	srv.Players, srv.MaxPlayers, srv.Protocol = int(nums[0]), int(nums[1]), int(nums[2])
+	return &srv, nil
+}
+
+// Query sends a server info request to each of addrs over conn and collects
+// the replies that arrive before timeout elapses.  A server that answers more
+// than once is reported once.
+func Query(conn net.PacketConn, addrs []net.Addr, timeout time.Duration) ([]*Server, error) {
+	req := Request()
+	for _, addr := range addrs {
+		if _, err := conn.WriteTo(req, addr); err != nil {
+			return nil, err
+		}
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	var (
+		out  []*Server
+		seen = make(map[string]bool)
+		buf  [protonetquake.MaxDatagram]byte
+	)
+	for {
+		n, from, err := conn.ReadFrom(buf[:])
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				return out, nil
+			}
+			return out, err
+		}
+		srv, err := ParseReply(buf[:n])
+		if err != nil || seen[from.String()] {
+			continue
+		}
+		seen[from.String()] = true
+		srv.Addr = from
+		out = append(out, srv)
+	}
+}
+
+// WriteTable prints servers in the manner of the stock slist command.
+func WriteTable(w io.Writer, servers []*Server) error {
+	sorted := make([]*Server, len(servers))
+	copy(sorted, servers)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Hostname < sorted[j].Hostname })
+	if _, err := fmt.Fprintf(w, "%-15s %-15s %-5s %s\n%s %s %s %s\n",
+		"Server", "Map", "Users", "Address",
+		"---------------", "---------------", "-----", "---------------"); err != nil {
+		return err
+	}
+	for _, s := range sorted {
+		if _, err := fmt.Fprintf(w, "%-15.15s %-15.15s %2d/%2d %s\n",
+			s.Hostname, s.Map, s.Players, s.MaxPlayers, s.Addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
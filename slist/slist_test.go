@@ -0,0 +1,97 @@
+package slist
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/matttproud/go-quake/proto/protonetquake"
+)
+
+func TestRequest(t *testing.T) {
+	if got, want := Request(), []byte("\x80\x00\x00\x0c\x02QUAKE\x00\x03"); !bytes.Equal(got, want) {
+		t.Errorf("got = %q, want = %q", got, want)
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	for _, test := range []struct {
+		data []byte
+		srv  *Server
+		err  error
+	}{
+		{
+			data: []byte("\x80\x00\x00\x21\x8310.0.0.1:26000\x00test\x00e1m1\x00\x01\x04\x03"),
+			srv: &Server{
+				Address:    "10.0.0.1:26000",
+				Hostname:   "test",
+				Map:        "e1m1",
+				Players:    1,
+				MaxPlayers: 4,
+				Protocol:   3,
+			},
+		},
+		{
+			data: []byte("\x80\x00"),
+			err:  ErrBadReply("too short"),
+		},
+		{
+			data: []byte("\x80\x00\x00\x09\x85abc\x00"),
+			err:  ErrBadReply("unexpected command 0x85"),
+		},
+		{
+			data: []byte("\x80\x00\x00\x0b\x83a\x00b\x00c\x00"),
+			err:  ErrBadReply("truncated counts"),
+		},
+		{
+			data: []byte("\x80\x00\x00\x09\x83a\x00b\x00"),
+			err:  ErrBadReply("truncated string"),
+		},
+	} {
+		srv, err := ParseReply(test.data)
+		if got, want := srv, test.srv; !reflect.DeepEqual(got, want) {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+		if got, want := err, test.err; got != want {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	srv, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	go func() {
+		var buf [protonetquake.MaxDatagram]byte
+		n, from, err := srv.ReadFrom(buf[:])
+		if err != nil || !bytes.Equal(buf[:n], Request()) {
+			return
+		}
+		reply := []byte("\x80\x00\x00\x21\x8310.0.0.1:26000\x00test\x00e1m1\x00\x01\x04\x03")
+		srv.WriteTo(reply, from)
+		srv.WriteTo(reply, from)
+	}()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	servers, err := Query(conn, []net.Addr{srv.LocalAddr()}, 250*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(servers), 1; got != want {
+		t.Fatalf("got = %v, want = %v", got, want)
+	}
+	if got, want := servers[0].Addr.String(), srv.LocalAddr().String(); got != want {
+		t.Errorf("got = %v, want = %v", got, want)
+	}
+	if got, want := servers[0].Hostname, "test"; got != want {
+		t.Errorf("got = %v, want = %v", got, want)
+	}
+}